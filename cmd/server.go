@@ -43,6 +43,15 @@ twilio:
   accountSid: none
   authToken: none
   messagingServiceSid: none
+
+messenger:
+  driver: stdout
+
+smtp:
+  host: "127.0.0.1"
+  port: 1025
+  from: "kronus@localhost.com"
+  enableEmail: false
 `
 
 var serverCongFile string
@@ -118,9 +127,16 @@ func serverConfig() (*shared.ServerConfig, error) {
 	config.BindEnv("kronus.listener.port", "KRONUS_PORT")
 
 	config.SetDefault("kronus.cron.timeZone", "UTC")
+	config.SetDefault("kronus.cron.catchUpWindowInHours", 24)
 	config.SetDefault("kronus.listener.port", 3900)
+	config.SetDefault("kronus.workers.concurrency", 1)
+	config.SetDefault("kronus.workers.retention.successfulJobsInDays", 7)
+	config.SetDefault("kronus.workers.retention.deadJobsInDays", 90)
+	config.SetDefault("kronus.workers.retention.pruneSchedule", "0 3 * * *")
 	config.SetDefault("google.storage.prefix", "kronus")
 	config.SetDefault("google.storage.sqliteBackupSchedule", "*/15 * * * *")
+	config.SetDefault("messenger.driver", "twilio")
+	config.SetDefault("smtp.port", 587)
 
 	// if no config file provided, use dev config
 	if isDevEnv && serverCongFile == "" {
@@ -157,6 +173,7 @@ func validatedConfigStruct(config *viper.Viper) (*shared.ServerConfig, error) {
 	// work as expected i.e. a field will only be required if 'EnableSqliteBackupAndSync' is
 	// provided i.e. 'true' since 'false' will be set to 'nil'
 	setEnableSqliteBackupFieldToNilIfFalse(&serverConfig)
+	setEnableEmailFieldToNilIfFalse(&serverConfig)
 
 	// Exit on validation errors - as error format is better than the default
 	if errs := validate.Struct(serverConfig); errs != nil {
@@ -186,3 +203,9 @@ func setEnableSqliteBackupFieldToNilIfFalse(config *shared.ServerConfig) {
 		config.Google.Storage.EnableSqliteBackupAndSync = nil
 	}
 }
+
+func setEnableEmailFieldToNilIfFalse(config *shared.ServerConfig) {
+	if enabled, ok := config.Smtp.EnableEmail.(bool); ok && !enabled {
+		config.Smtp.EnableEmail = nil
+	}
+}
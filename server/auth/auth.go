@@ -1,13 +1,30 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Daskott/kronus/server/auth/key"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Purposes for link tokens. A token created for one purpose can't be used for another.
+const (
+	CHECK_IN_LINK_TOKEN        = "kronus-check-in-token"
+	ACKNOWLEDGEMENT_LINK_TOKEN = "kronus-acknowledgement-token"
+)
+
+const linkTokenSignatureBytes = 12
+
+var ErrInvalidLinkToken = errors.New("invalid link token")
+
 type KronusTokenClaims struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
@@ -57,3 +74,56 @@ func DecodeJWT(tokenString string, keyPair *key.KeyPair) (*KronusTokenClaims, er
 
 	return tokenClaims, nil
 }
+
+// EncodeLinkToken returns a short url-safe token for a link e.g. a probe check-in link.
+// The token identifies the record with 'id', is signed with a key derived from 'keyPair' for 'purpose'
+// & expires at 'expiresAt'.
+func EncodeLinkToken(purpose string, id uint, expiresAt time.Time, keyPair *key.KeyPair) string {
+	payload := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(payload, uint64(id))
+	n += binary.PutUvarint(payload[n:], uint64(expiresAt.Unix()))
+	payload = payload[:n]
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(linkTokenSignature(purpose, payload, keyPair))
+}
+
+// DecodeLinkToken verifies the link 'token' was created for 'purpose' & returns the ID of the record it identifies
+func DecodeLinkToken(purpose string, token string, keyPair *key.KeyPair) (uint, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 2 {
+		return 0, ErrInvalidLinkToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return 0, ErrInvalidLinkToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil || !hmac.Equal(signature, linkTokenSignature(purpose, payload, keyPair)) {
+		return 0, ErrInvalidLinkToken
+	}
+
+	id, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return 0, ErrInvalidLinkToken
+	}
+
+	expiresAt, m := binary.Uvarint(payload[n:])
+	if m <= 0 {
+		return 0, ErrInvalidLinkToken
+	}
+
+	if time.Now().Unix() > int64(expiresAt) {
+		return 0, fmt.Errorf("%w: token expired", ErrInvalidLinkToken)
+	}
+
+	return uint(id), nil
+}
+
+func linkTokenSignature(purpose string, payload []byte, keyPair *key.KeyPair) []byte {
+	mac := hmac.New(sha256.New, keyPair.HMACKey(purpose))
+	mac.Write(payload)
+	return mac.Sum(nil)[:linkTokenSignatureBytes]
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Daskott/kronus/server/auth/key"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyPair(t *testing.T) *key.KeyPair {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	return &key.KeyPair{Kid: "test-key-id", PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}
+}
+
+func TestLinkToken(t *testing.T) {
+	keyPair := testKeyPair(t)
+
+	token := EncodeLinkToken(CHECK_IN_LINK_TOKEN, 42, time.Now().Add(time.Hour), keyPair)
+	assert.Less(t, len(token), 40, "Token should be short enough for an sms")
+
+	probeID, err := DecodeLinkToken(CHECK_IN_LINK_TOKEN, token, keyPair)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(42), probeID)
+
+	// Token signed with a different key
+	_, err = DecodeLinkToken(CHECK_IN_LINK_TOKEN, token, testKeyPair(t))
+	assert.True(t, errors.Is(err, ErrInvalidLinkToken))
+
+	// Token with tampered payload
+	otherToken := EncodeLinkToken(CHECK_IN_LINK_TOKEN, 43, time.Now().Add(time.Hour), keyPair)
+	tamperedToken := strings.Split(otherToken, ".")[0] + "." + strings.Split(token, ".")[1]
+	_, err = DecodeLinkToken(CHECK_IN_LINK_TOKEN, tamperedToken, keyPair)
+	assert.True(t, errors.Is(err, ErrInvalidLinkToken))
+
+	// Token created for a different purpose
+	_, err = DecodeLinkToken(ACKNOWLEDGEMENT_LINK_TOKEN, token, keyPair)
+	assert.True(t, errors.Is(err, ErrInvalidLinkToken))
+
+	// Expired token
+	expiredToken := EncodeLinkToken(CHECK_IN_LINK_TOKEN, 42, time.Now().Add(-time.Minute), keyPair)
+	_, err = DecodeLinkToken(CHECK_IN_LINK_TOKEN, expiredToken, keyPair)
+	assert.True(t, errors.Is(err, ErrInvalidLinkToken))
+}
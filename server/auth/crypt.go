@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/Daskott/kronus/server/auth/key"
+)
+
+// Purposes for encrypted data. Data encrypted for one purpose can't be decrypted for another.
+const (
+	RELEASE_PAYLOAD_ENCRYPTION = "kronus-release-payload"
+)
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// Encrypt encrypts 'plaintext' with AES-256-GCM, using a key derived from 'keyPair' for 'purpose'.
+// The random nonce is prepended to the returned ciphertext.
+func Encrypt(purpose string, plaintext []byte, keyPair *key.KeyPair) ([]byte, error) {
+	aead, err := newAEAD(purpose, keyPair)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("unable to generate nonce: %v", err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(purpose)), nil
+}
+
+// Decrypt decrypts 'ciphertext' created by Encrypt for the same 'purpose'
+func Decrypt(purpose string, ciphertext []byte, keyPair *key.KeyPair) ([]byte, error) {
+	aead, err := newAEAD(purpose, keyPair)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(purpose))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(purpose string, keyPair *key.KeyPair) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(keyPair.EncryptionKey(purpose))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncrypt(t *testing.T) {
+	keyPair := testKeyPair(t)
+	plaintext := []byte("The keys are in the blue vase")
+
+	ciphertext, err := Encrypt(RELEASE_PAYLOAD_ENCRYPTION, plaintext, keyPair)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(ciphertext), string(plaintext))
+
+	decrypted, err := Decrypt(RELEASE_PAYLOAD_ENCRYPTION, ciphertext, keyPair)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Encrypted with a different key
+	_, err = Decrypt(RELEASE_PAYLOAD_ENCRYPTION, ciphertext, testKeyPair(t))
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext))
+
+	// Encrypted for a different purpose
+	_, err = Decrypt("kronus-other-purpose", ciphertext, keyPair)
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext))
+
+	// Tampered ciphertext
+	ciphertext[len(ciphertext)-1] ^= 0xff
+	_, err = Decrypt(RELEASE_PAYLOAD_ENCRYPTION, ciphertext, keyPair)
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext))
+
+	_, err = Decrypt(RELEASE_PAYLOAD_ENCRYPTION, []byte("short"), keyPair)
+	assert.True(t, errors.Is(err, ErrInvalidCiphertext))
+}
@@ -2,6 +2,8 @@ package key
 
 import (
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"fmt"
 
 	"github.com/golang-jwt/jwt"
@@ -40,6 +42,21 @@ func (keyPair *KeyPair) JWK() (jwk.Key, error) {
 	return keyPairJWK, nil
 }
 
+// HMACKey returns a symmetric key derived from the private key, for the given 'purpose'.
+// It's used for signatures that need to be shorter than an RSA signature e.g. in urls.
+func (keyPair *KeyPair) HMACKey(purpose string) []byte {
+	hash := sha256.New()
+	hash.Write([]byte(purpose))
+	hash.Write(x509.MarshalPKCS1PrivateKey(keyPair.PrivateKey))
+	return hash.Sum(nil)
+}
+
+// EncryptionKey returns a 256-bit symmetric key derived from the private key, for the given 'purpose'.
+// It's kept separate from the HMAC keys, so a key is never used for both signing & encryption.
+func (keyPair *KeyPair) EncryptionKey(purpose string) []byte {
+	return keyPair.HMACKey("encryption:" + purpose)
+}
+
 func ExportJWKAsJWKS(jwk jwk.Key) JWKS {
 	return JWKS{Keys: []interface{}{jwk}}
 }
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Probe lifecycle events
+const (
+	PROBE_SENT        = "probe.sent"
+	PROBE_GOOD        = "probe.good"
+	PROBE_BAD         = "probe.bad"
+	PROBE_UNAVAILABLE = "probe.unavailable"
+	PROBE_CANCELLED   = "probe.cancelled"
+	EMERGENCY_SENT    = "emergency.sent"
+)
+
+// Job events, published when a job moves between queues
+const (
+	JOB_ENQUEUED    = "job.enqueued"
+	JOB_IN_PROGRESS = "job.in-progress"
+	JOB_SCHEDULED   = "job.scheduled"
+	JOB_SUCCESSFUL  = "job.successful"
+	JOB_DEAD        = "job.dead"
+)
+
+// Types lists the probe lifecycle event types, which webhooks can subscribe to
+var Types = []string{PROBE_SENT, PROBE_GOOD, PROBE_BAD, PROBE_UNAVAILABLE, PROBE_CANCELLED, EMERGENCY_SENT}
+
+type Event struct {
+	Type string `json:"event"`
+
+	// The user the event is for. It's 0 for events that aren't for a user e.g. job events
+	UserID    uint        `json:"user_id"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type Subscriber func(event Event)
+
+var (
+	mu               sync.RWMutex
+	subscribers      = make(map[int]Subscriber)
+	nextSubscriberID int
+)
+
+// Subscribe registers 'subscriber' to be called with every event published.
+// It returns a func to unsubscribe.
+func Subscribe(subscriber Subscriber) func() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	id := nextSubscriberID
+	nextSubscriberID++
+	subscribers[id] = subscriber
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// SubscribeChan returns a channel that receives every event published, along with a func to unsubscribe.
+// If the channel's buffer of 'bufferSize' is full, events are dropped instead of blocking publishers.
+func SubscribeChan(bufferSize int) (<-chan Event, func()) {
+	stream := make(chan Event, bufferSize)
+
+	unsubscribe := Subscribe(func(event Event) {
+		select {
+		case stream <- event:
+		default:
+		}
+	})
+
+	return stream, unsubscribe
+}
+
+// Publish sends a new event of 'eventType' for the user with 'userID' to all subscribers.
+// Subscribers are called synchronously, so they shouldn't block.
+func Publish(eventType string, userID uint, data interface{}) {
+	// Subscribers are called without holding the lock, as they may publish events of their own
+	mu.RLock()
+	current := make([]Subscriber, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		current = append(current, subscriber)
+	}
+	mu.RUnlock()
+
+	event := Event{Type: eventType, UserID: userID, Data: data, CreatedAt: time.Now()}
+	for _, subscriber := range current {
+		subscriber(event)
+	}
+}
+
+// JobEventType returns the event type published when a job moves to the queue with 'jobStatus' e.g. 'job.dead'
+func JobEventType(jobStatus string) string {
+	return "job." + jobStatus
+}
+
+// IsValidType returns true if 'eventType' is a probe lifecycle event type
+func IsValidType(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
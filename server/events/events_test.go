@@ -0,0 +1,24 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeChan(t *testing.T) {
+	stream, unsubscribe := SubscribeChan(1)
+
+	Publish(PROBE_GOOD, 1, "first")
+	Publish(PROBE_BAD, 1, "dropped, as the buffer is full")
+
+	event := <-stream
+	assert.Equal(t, PROBE_GOOD, event.Type)
+	assert.Equal(t, uint(1), event.UserID)
+	assert.Equal(t, "first", event.Data)
+	assert.Len(t, stream, 0)
+
+	unsubscribe()
+	Publish(PROBE_GOOD, 1, "after unsubscribe")
+	assert.Len(t, stream, 0, "Should not receive events after unsubscribing")
+}
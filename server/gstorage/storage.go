@@ -56,6 +56,11 @@ func NewGStorage(credentialsFilePath, bucket, objectsPrefix string) (*GStorage,
 
 // UploadFile uploads an object.
 func (gs *GStorage) UploadFile(filePath string) error {
+	return gs.UploadFileWithContext(context.Background(), filePath)
+}
+
+// UploadFileWithContext uploads an object, unless 'ctx' is cancelled first.
+func (gs *GStorage) UploadFileWithContext(ctx context.Context, filePath string) error {
 
 	// Open local file in filePath
 	f, err := os.Open(filePath)
@@ -64,7 +69,7 @@ func (gs *GStorage) UploadFile(filePath string) error {
 	}
 	defer f.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
 	defer cancel()
 
 	// Upload an object with storage.Writer.
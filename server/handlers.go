@@ -5,6 +5,8 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,7 +14,10 @@ import (
 
 	"github.com/Daskott/kronus/server/auth"
 	"github.com/Daskott/kronus/server/auth/key"
+	"github.com/Daskott/kronus/server/events"
 	"github.com/Daskott/kronus/server/models"
+	"github.com/Daskott/kronus/server/webhook"
+	"github.com/Daskott/kronus/server/work"
 	"github.com/gorilla/mux"
 
 	"github.com/golang-jwt/jwt"
@@ -35,6 +40,111 @@ type TwilioSmsResponse struct {
 	Message string
 }
 
+type EscalationPolicyPayload struct {
+	Steps []models.EscalationStep `json:"steps" validate:"max=5,dive"`
+}
+
+type ProbePinsPayload struct {
+	SafePin   string `json:"safe_pin,omitempty" validate:"omitempty,numeric,min=4,max=8"`
+	DuressPin string `json:"duress_pin,omitempty" validate:"omitempty,numeric,min=4,max=8,nefield=SafePin"`
+
+	// A pin is only removed when it's explicitly cleared, so setting one pin keeps the other
+	ClearSafePin   bool `json:"clear_safe_pin,omitempty"`
+	ClearDuressPin bool `json:"clear_duress_pin,omitempty"`
+}
+
+// ProbePinsStatus shows which pins a user has set, without exposing them
+type ProbePinsStatus struct {
+	SafePin   bool `json:"safe_pin"`
+	DuressPin bool `json:"duress_pin"`
+}
+
+type SnoozePayload struct {
+	// Defaults to now
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   time.Time  `json:"ends_at" validate:"required"`
+}
+
+// DynamicProbePayload is an on-demand probe, like the one sent for the sms 'probe' cmd
+type DynamicProbePayload struct {
+	// Minutes from now to send the probe
+	DelayInMinutes    int `json:"delay_in_minutes" validate:"gte=0,lte=1440"`
+	MaxRetries        int `json:"max_retries" validate:"gte=0,lte=6"`
+	WaitTimeInMinutes int `json:"wait_time_in_minutes" validate:"gte=5,lte=120"`
+}
+
+type ProbeResponsePayload struct {
+	Response string `json:"response" validate:"required,oneof=good bad"`
+}
+
+// NewReleasePayload is a release payload as it's sent by the user, before it's encrypted
+type NewReleasePayload struct {
+	Name           string                        `json:"name" validate:"required,max=50"`
+	ContactID      uint                          `json:"contact_id" validate:"required"`
+	Message        string                        `json:"message" validate:"required,max=1600"`
+	DelayInMinutes int                           `json:"delay_in_minutes" validate:"gte=0,lte=10080"`
+	Attachments    []NewReleasePayloadAttachment `json:"attachments" validate:"max=3,dive"`
+}
+
+type NewReleasePayloadAttachment struct {
+	FileName    string `json:"file_name" validate:"required,max=255"`
+	ContentType string `json:"content_type" validate:"max=255"`
+
+	// Base64 encoded, and at most 2MB once decoded
+	Content []byte `json:"content" validate:"required,max=2097152"`
+}
+
+type WebhookPayload struct {
+	Url    string   `json:"url" validate:"required,url,startswith=http"`
+	Events []string `json:"events" validate:"required,min=1,dive,webhook_event"`
+
+	// Defaults to true
+	Active *bool `json:"active"`
+}
+
+// CreatedWebhook is the response for a new webhook, the only time its secret is returned
+type CreatedWebhook struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+type RetryJobsPayload struct {
+	Handler string `json:"handler" validate:"required"`
+}
+
+// LinkPage is a minimal html page opened from a link in a message e.g. a probe check-in link
+type LinkPage struct {
+	Title   string
+	Message string
+	Action  string
+	Buttons []LinkPageButton
+}
+
+type LinkPageButton struct {
+	Value string
+	Label string
+}
+
+var linkPageTemplate = template.Must(template.New("link_page").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{.Title}}</title>
+  </head>
+  <body style="font-family: Arial, Helvetica, sans-serif; text-align: center; padding: 2em;">
+    <h2>{{.Title}}</h2>
+    {{if .Message}}<p>{{.Message}}</p>{{end}}
+    {{if .Buttons}}
+    <form method="POST" action="{{.Action}}">
+      {{range .Buttons}}<button type="submit" name="response" value="{{.Value}}" style="font-size: 1.2em; margin: 0.5em;">{{.Label}}</button>
+      {{end}}
+    </form>
+    {{end}}
+  </body>
+</html>
+`))
+
 func createUserHandler(rw http.ResponseWriter, r *http.Request) {
 	user := models.User{}
 	decoder := json.NewDecoder(r.Body)
@@ -113,7 +223,25 @@ func findUserHandler(rw http.ResponseWriter, r *http.Request) {
 }
 
 func deleteUserHandler(rw http.ResponseWriter, r *http.Request) {
-	err := models.DeleteUser(r.Context().Value(RequestContextKey("userID")))
+	user, err := models.FindUserBy("ID", r.Context().Value(RequestContextKey("userID")))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	// Remove the user's periodic probes, so they aren't left running (& in the db) for a user who no longer exists
+	err = probeScheduler.DisableAllPeriodicProbes(user)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	err = models.DeleteUser(user.ID)
 	if err != nil {
 		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
 		return
@@ -214,6 +342,13 @@ func updateProbeSettingsHandler(rw http.ResponseWriter, r *http.Request) {
 		"cron_expression":      true,
 		"max_retries":          true,
 		"wait_time_in_minutes": true,
+		"time_zone":            true,
+
+		"jitter_window_in_minutes": true,
+
+		"quiet_hours_start":              true,
+		"quiet_hours_end":                true,
+		"emergency_bypasses_quiet_hours": true,
 	})
 	if len(params) <= 0 {
 		writeResponse(rw,
@@ -239,6 +374,26 @@ func updateProbeSettingsHandler(rw http.ResponseWriter, r *http.Request) {
 		errs = append(errs, "'active' field must be a boolean e.g. true/false")
 	}
 
+	if params["jitter_window_in_minutes"] != nil {
+		if err := validate.Var(params["jitter_window_in_minutes"], "gte=0,lte=720"); err != nil {
+			errs = append(errs, "valid 'jitter_window_in_minutes' field is required. And it must be >=0 and <= 720")
+		}
+	}
+
+	if params["time_zone"] != nil && !isValidTimeZone(params["time_zone"]) {
+		errs = append(errs, "'time_zone' field must be a valid time zone e.g. 'America/Toronto', or '' to use the server's")
+	}
+
+	for _, field := range []string{"quiet_hours_start", "quiet_hours_end"} {
+		if params[field] != nil && !isValidQuietHoursTime(params[field]) {
+			errs = append(errs, fmt.Sprintf("'%v' field must be a valid time e.g. '22:00', or '' to remove it", field))
+		}
+	}
+
+	if _, ok := params["emergency_bypasses_quiet_hours"].(bool); params["emergency_bypasses_quiet_hours"] != nil && !ok {
+		errs = append(errs, "'emergency_bypasses_quiet_hours' field must be a boolean e.g. true/false")
+	}
+
 	if params["cron_expression"] != nil && !isValidCronExpression(params["cron_expression"].(string)) {
 		errs = append(errs, "'cron_expression' field must be valid e.g. '0 18 * * 3'")
 	}
@@ -248,17 +403,9 @@ func updateProbeSettingsHandler(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Only activate liveliness probe for users with emergency contact
+	// Only activate liveliness probe for users with emergency contact or escalation policy
 	if enableProbe, ok := params["active"].(bool); ok && enableProbe {
-		contact, err := currentUser.EmergencyContact()
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
-			return
-		}
-
-		if contact == nil {
-			writeResponse(rw, ResponsePayload{Errors: []string{
-				"an emergency contact is required to enable liveliness probe i.e 'active = true'"}}, http.StatusForbidden)
+		if ok := requireEscalationChain(rw, currentUser); !ok {
 			return
 		}
 	}
@@ -271,7 +418,18 @@ func updateProbeSettingsHandler(rw http.ResponseWriter, r *http.Request) {
 
 	// If probe request is `Active` after update, update the probeScheduler with the user's probe settings
 	if currentUser.ProbeSettings.Active {
-		probeScheduler.PeriodicallyPerfomProbe(*currentUser)
+		if err := probeScheduler.PeriodicallyPerfomProbe(*currentUser); err != nil {
+			writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Probe schedules are scheduled in the user's time zone too
+	if params["time_zone"] != nil {
+		if err := rescheduleActiveProbeSchedules(currentUser); err != nil {
+			writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// Remove user probe from probeScheduler if disabled
@@ -416,6 +574,105 @@ func fetchUserProbesHandler(rw http.ResponseWriter, r *http.Request) {
 	writeResponse(rw, ResponsePayload{Success: true, Data: probes, Paging: paging}, http.StatusOK)
 }
 
+// createProbeHandler schedules an on-demand probe for the user, with the same defaults as the sms 'probe' cmd
+func createProbeHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	dynamicProbe := DynamicProbePayload{DelayInMinutes: 5, MaxRetries: 3, WaitTimeInMinutes: 10}
+
+	// An empty body uses the defaults
+	err := json.NewDecoder(r.Body).Decode(&dynamicProbe)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(dynamicProbe)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	steps, err := currentUser.EscalationChain()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	if len(steps) == 0 {
+		writeResponse(rw, ResponsePayload{Errors: []string{
+			"an emergency contact is required to send a probe"}}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = scheduleDynamicProbe(currentUser, dynamicProbe)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: dynamicProbe}, http.StatusOK)
+}
+
+// cancelProbeHandler cancels one of the user's pending probes, so no more retries or emergency probes are sent for it
+func cancelProbeHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	probe, ok := findPendingProbe(rw, currentUser, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	err := probe.Resolve(models.CANCELLED_PROBE)
+	if errors.Is(err, models.ErrProbeNotPending) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"only a pending probe can be updated"}}, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeProbeResponse(rw, currentUser, probe.ID)
+}
+
+// respondToProbeHandler responds to one of the user's pending probes, in the same way as replying to the probe's sms
+func respondToProbeHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	probeResponse := ProbeResponsePayload{}
+
+	err := json.NewDecoder(r.Body).Decode(&probeResponse)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(probeResponse)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	probe, ok := findPendingProbe(rw, currentUser, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	probe.LastResponse = CheckInLinkResponses[probeResponse.Response]
+	_, err = resolvePendingProbe(probe, probeResponse.Response)
+	if errors.Is(err, models.ErrProbeNotPending) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"only a pending probe can be updated"}}, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeProbeResponse(rw, currentUser, probe.ID)
+}
+
 func fetchUserContactsHandler(rw http.ResponseWriter, r *http.Request) {
 	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
@@ -459,8 +716,7 @@ func fetchJobsHandler(rw http.ResponseWriter, r *http.Request) {
 
 	if status != "" && !models.JobStatusNameMap[status] {
 		writeResponse(rw, ResponsePayload{Errors: []string{
-			fmt.Sprintf("a valid 'status' param is required i.e. %v, %v, %v or %v",
-				models.ENQUEUED_JOB, models.SUCCESSFUL_JOB, models.IN_PROGRESS_JOB, models.DEAD_JOB)},
+			fmt.Sprintf("a valid 'status' param is required i.e. %v", listNames(models.JobStatusNameMap))},
 		}, http.StatusBadRequest)
 		return
 	}
@@ -479,6 +735,166 @@ func fetchJobsHandler(rw http.ResponseWriter, r *http.Request) {
 	writeResponse(rw, ResponsePayload{Success: true, Data: jobs, Paging: paging}, http.StatusOK)
 }
 
+func findJobHandler(rw http.ResponseWriter, r *http.Request) {
+	job, err := models.FindJob(mux.Vars(r)["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"job not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: job}, http.StatusOK)
+}
+
+func fetchJobAttemptsHandler(rw http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	job, err := models.FindJob(mux.Vars(r)["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"job not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	attempts, paging, err := models.FetchJobAttempts(job.ID, page)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: attempts, Paging: paging}, http.StatusOK)
+}
+
+func deleteJobHandler(rw http.ResponseWriter, r *http.Request) {
+	err := models.DeleteJob(mux.Vars(r)["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"job not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, models.ErrJobInProgress) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
+}
+
+// retryJobHandler moves a dead job back to the queue, with its fails reset
+func retryJobHandler(rw http.ResponseWriter, r *http.Request) {
+	job, err := workerPool.Retry(mux.Vars(r)["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"job not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, models.ErrJobNotDead) || errors.Is(err, models.ErrDuplicateJob) || errors.Is(err, work.ErrUnknownHandler) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: job}, http.StatusOK)
+}
+
+// retryDeadJobsHandler moves all dead jobs for the 'handler' param back to the queue
+func retryDeadJobsHandler(rw http.ResponseWriter, r *http.Request) {
+	retryJobs := RetryJobsPayload{}
+
+	err := json.NewDecoder(r.Body).Decode(&retryJobs)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(retryJobs)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	retried, err := workerPool.RetryAll(retryJobs.Handler)
+	if errors.Is(err, work.ErrUnknownHandler) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: map[string]int64{"retried_job_count": retried}}, http.StatusOK)
+}
+
+// cancelJobHandler removes a scheduled job before it's added to the queue
+func cancelJobHandler(rw http.ResponseWriter, r *http.Request) {
+	err := workerPool.Cancel(mux.Vars(r)["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"job not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, models.ErrJobNotScheduled) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
+}
+
+func fetchPeriodicJobsHandler(rw http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	periodicJobs, paging, err := models.FetchPeriodicJobs(page)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: periodicJobs, Paging: paging}, http.StatusOK)
+}
+
+// pausePeriodicJobHandler stops a periodic job from being added to the queue, until it's resumed
+func pausePeriodicJobHandler(rw http.ResponseWriter, r *http.Request) {
+	periodicJob, err := workerPool.PausePeriodicJob(mux.Vars(r)["id"])
+	writePeriodicJobResponse(rw, periodicJob, err)
+}
+
+// resumePeriodicJobHandler schedules a paused periodic job, to be added to the queue again
+func resumePeriodicJobHandler(rw http.ResponseWriter, r *http.Request) {
+	periodicJob, err := workerPool.ResumePeriodicJob(mux.Vars(r)["id"])
+	writePeriodicJobResponse(rw, periodicJob, err)
+}
+
+// triggerPeriodicJobHandler adds a periodic job to the queue right away
+func triggerPeriodicJobHandler(rw http.ResponseWriter, r *http.Request) {
+	periodicJob, err := workerPool.TriggerPeriodicJob(mux.Vars(r)["id"])
+	writePeriodicJobResponse(rw, periodicJob, err)
+}
+
 func fetchProbesHandler(rw http.ResponseWriter, r *http.Request) {
 	var probes []models.Probe
 	var paging *models.Paging
@@ -523,6 +939,18 @@ func smsWebhookHandler(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Emergency contacts may not be users, so handle acknowledgements before looking up the user
+	if strings.ToLower(strings.TrimSpace(message)) == "ack" {
+		response, err := handleAckCmd(r.PostForm.Get("From"))
+		if err != nil {
+			writeErrMsgForSmsWebhook(rw, err)
+			return
+		}
+
+		writeSmsWebHookResponse(rw, response, http.StatusOK)
+		return
+	}
+
 	user, err := models.FindUserBy("phone_number", r.PostForm.Get("From"))
 	if err != nil {
 		// No need to send response if user does not exist
@@ -542,6 +970,8 @@ func smsWebhookHandler(rw http.ResponseWriter, r *http.Request) {
 		response, err = handlePingCmd(message)
 	case strings.ToLower(firstArg) == "probe":
 		response, err = handleDynamicProbeCmd(user, message)
+	case strings.ToLower(firstArg) == "snooze":
+		response, err = handleSnoozeCmd(user, message)
 	case strings.ToLower(firstArg) == "usage":
 		response, err = handleHelpCmd(message)
 	default:
@@ -617,3 +1047,826 @@ func jwksHandler(rw http.ResponseWriter, r *http.Request) {
 func healthCheckHandler(rw http.ResponseWriter, r *http.Request) {
 	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
 }
+
+func checkInPageHandler(rw http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	_, err := pendingProbeFromCheckInToken(token)
+	if errors.Is(err, auth.ErrInvalidLinkToken) {
+		writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: "This check-in link is invalid or has expired."}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	writeLinkPage(rw, checkInPage(token, "Are you good ?"), http.StatusOK)
+}
+
+func checkInHandler(rw http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	r.ParseForm()
+
+	probeStatusName := r.PostForm.Get("response")
+	if probeStatusName != models.GOOD_PROBE && probeStatusName != models.BAD_PROBE {
+		writeLinkPage(rw, checkInPage(token,
+			fmt.Sprintf("a valid 'response' is required i.e. %v or %v", models.GOOD_PROBE, models.BAD_PROBE)),
+			http.StatusBadRequest)
+		return
+	}
+
+	probe, err := pendingProbeFromCheckInToken(token)
+	if errors.Is(err, auth.ErrInvalidLinkToken) {
+		writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: "This check-in link is invalid or has expired."}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	probe.LastResponse = CheckInLinkResponses[probeStatusName]
+	msg, err := resolvePendingProbe(probe, probeStatusName)
+	if errors.Is(err, models.ErrProbeNotPending) {
+		writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: "This check-in link is invalid or has expired."}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	writeLinkPage(rw, LinkPage{Title: CHECK_IN_PAGE_TITLE, Message: msg}, http.StatusOK)
+}
+
+func acknowledgementPageHandler(rw http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	emergencyProbe, err := emergencyProbeFromAcknowledgementToken(token)
+	if errors.Is(err, auth.ErrInvalidLinkToken) {
+		writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: "This link is invalid or has expired."}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if emergencyProbe.AcknowledgedAt != nil {
+		writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: "You've already acknowledged this alert."}, http.StatusOK)
+		return
+	}
+
+	writeLinkPage(rw, LinkPage{
+		Title:   ACKNOWLEDGEMENT_PAGE_TITLE,
+		Message: "Let everyone know you're reaching out.",
+		Action:  "/a/" + token,
+		Buttons: []LinkPageButton{{Value: "ack", Label: "I'm on it"}},
+	}, http.StatusOK)
+}
+
+func acknowledgementHandler(rw http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	emergencyProbe, err := emergencyProbeFromAcknowledgementToken(token)
+	if errors.Is(err, auth.ErrInvalidLinkToken) {
+		writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: "This link is invalid or has expired."}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	msg, err := acknowledgeEmergencyProbe(emergencyProbe)
+	if err != nil {
+		writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	writeLinkPage(rw, LinkPage{Title: ACKNOWLEDGEMENT_PAGE_TITLE, Message: msg}, http.StatusOK)
+}
+
+func snoozeHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	snooze := SnoozePayload{}
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&snooze)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(snooze)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	startsAt := time.Now()
+	if snooze.StartsAt != nil && snooze.StartsAt.After(startsAt) {
+		startsAt = *snooze.StartsAt
+	}
+
+	if errMsg := validateSnoozeWindow(startsAt, snooze.EndsAt); errMsg != "" {
+		writeResponse(rw, ResponsePayload{Errors: []string{errMsg}}, http.StatusBadRequest)
+		return
+	}
+
+	err = probeScheduler.Snooze(currentUser, startsAt, snooze.EndsAt)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: currentUser.ProbeSettings}, http.StatusOK)
+}
+
+func liftSnoozeHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	err := probeScheduler.LiftSnooze(currentUser)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: currentUser.ProbeSettings}, http.StatusOK)
+}
+
+func fetchProbePinsHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: ProbePinsStatus{
+		SafePin:   currentUser.ProbeSettings.HasPin(models.SAFE_PIN),
+		DuressPin: currentUser.ProbeSettings.HasPin(models.DURESS_PIN),
+	}}, http.StatusOK)
+}
+
+func updateProbePinsHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	pins := ProbePinsPayload{}
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&pins)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(pins)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	if (pins.SafePin != "" && pins.ClearSafePin) || (pins.DuressPin != "" && pins.ClearDuressPin) {
+		writeResponse(rw,
+			ResponsePayload{Errors: []string{"a pin can't be set & cleared at the same time"}},
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	// A new pin can't be the same as the other pin the user keeps, as a reply with it would be ambiguous
+	probeSettings := currentUser.ProbeSettings
+	if (pins.SafePin != "" && pins.DuressPin == "" && !pins.ClearDuressPin &&
+		probeSettings.MatchPin(pins.SafePin) == models.DURESS_PIN) ||
+		(pins.DuressPin != "" && pins.SafePin == "" && !pins.ClearSafePin &&
+			probeSettings.MatchPin(pins.DuressPin) == models.SAFE_PIN) {
+		writeResponse(rw,
+			ResponsePayload{Errors: []string{"safe_pin & duress_pin must be different"}},
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	pinsToClear := []string{}
+	if pins.ClearSafePin {
+		pinsToClear = append(pinsToClear, models.SAFE_PIN)
+	}
+	if pins.ClearDuressPin {
+		pinsToClear = append(pinsToClear, models.DURESS_PIN)
+	}
+
+	err = currentUser.ClearProbePins(pinsToClear...)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	err = currentUser.SetProbePins(pins.SafePin, pins.DuressPin)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: ProbePinsStatus{
+		SafePin:   currentUser.ProbeSettings.HasPin(models.SAFE_PIN),
+		DuressPin: currentUser.ProbeSettings.HasPin(models.DURESS_PIN),
+	}}, http.StatusOK)
+}
+
+func fetchProbeSchedulesHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	schedules, err := currentUser.FetchProbeSchedules()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: schedules}, http.StatusOK)
+}
+
+func createProbeScheduleHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	schedule := models.ProbeSchedule{MaxRetries: 3, WaitTimeInMinutes: 60}
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&schedule)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(schedule)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	if !isValidCronExpression(schedule.CronExpression) {
+		writeResponse(rw, ResponsePayload{Errors: []string{
+			"'cron_expression' field must be valid e.g. '0 18 * * 3'"}}, http.StatusBadRequest)
+		return
+	}
+
+	if schedule.Active {
+		if ok := requireEscalationChain(rw, currentUser); !ok {
+			return
+		}
+	}
+
+	err = currentUser.AddProbeSchedule(&schedule)
+
+	if errors.Is(err, models.ErrDuplicateProbeScheduleName) || errors.Is(err, models.ErrMaxProbeSchedules) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	if schedule.Active {
+		err = probeScheduler.PeriodicallyPerformProbeSchedule(*currentUser, schedule)
+		if err != nil {
+			writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: schedule}, http.StatusOK)
+}
+
+func updateProbeScheduleHandler(rw http.ResponseWriter, r *http.Request) {
+	var errs []string
+
+	vars := mux.Vars(r)
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	params := make(map[string]interface{})
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	removeUnknownFields(params, map[string]bool{
+		"name":                 true,
+		"active":               true,
+		"cron_expression":      true,
+		"max_retries":          true,
+		"wait_time_in_minutes": true,
+
+		"jitter_window_in_minutes": true,
+	})
+	if len(params) <= 0 {
+		writeResponse(rw,
+			ResponsePayload{Errors: []string{"valid fields required"}},
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if params["name"] != nil {
+		if err := validate.Var(params["name"], "required,max=50"); err != nil {
+			errs = append(errs, "valid 'name' field is required. And it must be <= 50 characters")
+		}
+	}
+
+	if params["max_retries"] != nil {
+		if err := validate.Var(params["max_retries"], "gte=0,lte=6"); err != nil {
+			errs = append(errs, "valid 'max_retries' field is required. And it must be <= 6")
+		}
+	}
+
+	if params["wait_time_in_minutes"] != nil {
+		if err := validate.Var(params["wait_time_in_minutes"], "gte=5,lte=120"); err != nil {
+			errs = append(errs, "valid 'wait_time_in_minutes' field is required. And it must be >=5 and <= 120")
+		}
+	}
+
+	if params["jitter_window_in_minutes"] != nil {
+		if err := validate.Var(params["jitter_window_in_minutes"], "gte=0,lte=720"); err != nil {
+			errs = append(errs, "valid 'jitter_window_in_minutes' field is required. And it must be >=0 and <= 720")
+		}
+	}
+
+	if _, ok := params["active"].(bool); params["active"] != nil && !ok {
+		errs = append(errs, "'active' field must be a boolean e.g. true/false")
+	}
+
+	if cronExpression, ok := params["cron_expression"].(string); params["cron_expression"] != nil &&
+		(!ok || !isValidCronExpression(cronExpression)) {
+		errs = append(errs, "'cron_expression' field must be valid e.g. '0 18 * * 3'")
+	}
+
+	if len(errs) > 0 {
+		writeResponse(rw, ResponsePayload{Errors: errs}, http.StatusBadRequest)
+		return
+	}
+
+	if enableProbe, ok := params["active"].(bool); ok && enableProbe {
+		if ok := requireEscalationChain(rw, currentUser); !ok {
+			return
+		}
+	}
+
+	schedule, err := currentUser.UpdateProbeSchedule(vars["id"], params)
+
+	if errors.Is(err, models.ErrDuplicateProbeScheduleName) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"probe schedule not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	if schedule.Active {
+		err = probeScheduler.PeriodicallyPerformProbeSchedule(*currentUser, *schedule)
+		if err != nil {
+			writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+			return
+		}
+	} else {
+		probeScheduler.RemoveProbeSchedule(*schedule)
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: schedule}, http.StatusOK)
+}
+
+func deleteProbeScheduleHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	vars := mux.Vars(r)
+
+	schedule, err := currentUser.FindProbeSchedule(vars["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"probe schedule not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	probeScheduler.RemoveProbeSchedule(*schedule)
+
+	err = currentUser.DeleteProbeSchedule(schedule.ID)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
+}
+
+func fetchEscalationPolicyHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	steps, err := currentUser.EscalationPolicy()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: EscalationPolicyPayload{Steps: steps}}, http.StatusOK)
+}
+
+func updateEscalationPolicyHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	policy := EscalationPolicyPayload{}
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&policy)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(policy)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	for i := 1; i < len(policy.Steps); i++ {
+		if policy.Steps[i].DelayInMinutes < policy.Steps[i-1].DelayInMinutes {
+			writeResponse(rw, ResponsePayload{Errors: []string{
+				"each step's 'delay_in_minutes' must be >= the previous step's 'delay_in_minutes'"}}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = currentUser.SetEscalationPolicy(policy.Steps)
+
+	if errors.Is(err, models.ErrInvalidEscalationContact) || errors.Is(err, models.ErrDuplicateEscalationContact) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	steps, err := currentUser.EscalationPolicy()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: EscalationPolicyPayload{Steps: steps}}, http.StatusOK)
+}
+
+func fetchReleasePayloadsHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	payloads, err := currentUser.FetchReleasePayloads()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: payloads}, http.StatusOK)
+}
+
+func createReleasePayloadHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	newPayload := NewReleasePayload{}
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&newPayload)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(newPayload)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	// Attachments can only be released by email
+	if len(newPayload.Attachments) > 0 && mailer == nil {
+		writeResponse(rw,
+			ResponsePayload{Errors: []string{"attachments can't be released, as email isn't enabled"}},
+			http.StatusUnprocessableEntity,
+		)
+		return
+	}
+
+	payload, err := encryptReleasePayload(newPayload)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	err = currentUser.AddReleasePayload(payload)
+
+	if errors.Is(err, models.ErrDuplicateReleasePayloadName) || errors.Is(err, models.ErrMaxReleasePayloads) ||
+		errors.Is(err, models.ErrUnknownReleasePayloadContact) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: payload}, http.StatusOK)
+}
+
+func deleteReleasePayloadHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	vars := mux.Vars(r)
+
+	err := currentUser.DeleteReleasePayload(vars["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"release payload not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
+}
+
+func fetchPayloadReleasesHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	payloadReleases, err := currentUser.FetchPendingPayloadReleases()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: payloadReleases}, http.StatusOK)
+}
+
+// cancelPayloadReleasesHandler cancels all the user's pending payload releases i.e. the user checking in
+func cancelPayloadReleasesHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	_, err := currentUser.CancelPendingPayloadReleases()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
+}
+
+func fetchWebhooksHandler(rw http.ResponseWriter, r *http.Request) {
+	webhooks, err := models.FetchWebhooks(webhookOwnerID(r))
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: webhooks}, http.StatusOK)
+}
+
+func createWebhookHandler(rw http.ResponseWriter, r *http.Request) {
+	payload := WebhookPayload{}
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&payload)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	errs := validate.Struct(payload)
+	if errs != nil {
+		writeResponse(rw, ResponsePayload{Errors: strings.Split(errs.Error(), "\n")}, http.StatusBadRequest)
+		return
+	}
+
+	if err := webhook.ValidateUrl(payload.Url); err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	newWebhook := models.Webhook{
+		Url:    payload.Url,
+		Events: models.WebhookEvents(payload.Events),
+		Active: payload.Active == nil || *payload.Active,
+		Secret: secret,
+	}
+
+	err = models.CreateWebhook(webhookOwnerID(r), &newWebhook)
+
+	if errors.Is(err, models.ErrMaxWebhooks) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: CreatedWebhook{Webhook: &newWebhook, Secret: secret}}, http.StatusOK)
+}
+
+func updateWebhookHandler(rw http.ResponseWriter, r *http.Request) {
+	var errs []string
+
+	vars := mux.Vars(r)
+	params := make(map[string]interface{})
+	decoder := json.NewDecoder(r.Body)
+
+	err := decoder.Decode(&params)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	removeUnknownFields(params, map[string]bool{
+		"url":    true,
+		"events": true,
+		"active": true,
+	})
+	if len(params) <= 0 {
+		writeResponse(rw,
+			ResponsePayload{Errors: []string{"valid fields required"}},
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if params["url"] != nil {
+		if err := validate.Var(params["url"], "required,url,startswith=http"); err != nil {
+			errs = append(errs, "valid 'url' field is required")
+		} else if err := webhook.ValidateUrl(fmt.Sprint(params["url"])); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if params["events"] != nil {
+		webhookEvents, ok := webhookEventsFromParam(params["events"])
+		if !ok {
+			errs = append(errs, fmt.Sprintf("'events' field must be a list of one or more of: %v",
+				strings.Join(events.Types, ", ")))
+		}
+		params["events"] = webhookEvents
+	}
+
+	if _, ok := params["active"].(bool); params["active"] != nil && !ok {
+		errs = append(errs, "'active' field must be a boolean e.g. true/false")
+	}
+
+	if len(errs) > 0 {
+		writeResponse(rw, ResponsePayload{Errors: errs}, http.StatusBadRequest)
+		return
+	}
+
+	existingWebhook, err := models.FindWebhook(webhookOwnerID(r), vars["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"webhook not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	err = existingWebhook.Update(params)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	updatedWebhook, err := models.FindWebhook(webhookOwnerID(r), existingWebhook.ID)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: updatedWebhook}, http.StatusOK)
+}
+
+func deleteWebhookHandler(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	existingWebhook, err := models.FindWebhook(webhookOwnerID(r), vars["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"webhook not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	err = models.DeleteWebhook(existingWebhook)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true}, http.StatusOK)
+}
+
+func fetchWebhookDeliveriesHandler(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	existingWebhook, err := models.FindWebhook(webhookOwnerID(r), vars["id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"webhook not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, paging, err := models.FetchWebhookDeliveries(existingWebhook.ID, page)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: deliveries, Paging: paging}, http.StatusOK)
+}
+
+// eventStreamHandler streams events as server-sent events, until the client disconnects or the server shuts down.
+// Admins get all events, while users only get the events for their own probes.
+func eventStreamHandler(rw http.ResponseWriter, r *http.Request) {
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		writeResponse(rw, ResponsePayload{Errors: []string{"streaming is not supported"}}, http.StatusInternalServerError)
+		return
+	}
+
+	isAdmin, err := currentUser.IsAdmin()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	stream, unsubscribe := events.SubscribeChan(EVENT_STREAM_BUFFER_SIZE)
+	defer unsubscribe()
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(rw, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(EVENT_STREAM_KEEP_ALIVE)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-stream:
+			if !isAdmin && event.UserID != currentUser.ID {
+				continue
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				logg.Error(err)
+				continue
+			}
+
+			fmt.Fprintf(rw, "event: %v\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,590 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Daskott/kronus/server/events"
+	"github.com/Daskott/kronus/server/messenger"
+	"github.com/Daskott/kronus/server/models"
+	"github.com/Daskott/kronus/server/pbscheduler"
+	"github.com/Daskott/kronus/server/twilio"
+	"github.com/Daskott/kronus/server/work"
+	"github.com/Daskott/kronus/shared"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+const (
+	TEST_PUBLIC_URL        = "https://kronus.test"
+	TEST_TWILIO_AUTH_TOKEN = "twilio-auth-token"
+	TEST_SMS_WEBHOOK_PATH  = "/v1/webhook/sms"
+)
+
+// setupTestServer sets up the server's validators, worker pool, probe scheduler & twilio client for a test.
+// It returns the messenger all messages are sent through.
+func setupTestServer(t *testing.T) *messenger.MemoryMessenger {
+	var err error
+
+	models.InitializeTestDb()
+	assert.Nil(t, RegisterValidators(validate))
+
+	workerPool, err = work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	probeScheduler, err = pbscheduler.NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	twilioClient = twilio.NewClient(shared.TwilioConfig{AuthToken: TEST_TWILIO_AUTH_TOKEN}, TEST_PUBLIC_URL)
+
+	return msgClient
+}
+
+// sendSms sends the sms 'body' from 'from' to the sms webhook, signed like twilio would.
+// It returns the message kronus replied with, if any.
+func sendSms(t *testing.T, from, body string) string {
+	form := url.Values{"From": {from}, "Body": {body}}
+
+	r := httptest.NewRequest(http.MethodPost, TEST_SMS_WEBHOOK_PATH, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Twilio-Signature", twilioSignature(TEST_PUBLIC_URL+TEST_SMS_WEBHOOK_PATH, form))
+
+	rw := httptest.NewRecorder()
+	smsWebhookHandler(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+	response := TwilioSmsResponse{}
+	assert.Nil(t, xml.Unmarshal(rw.Body.Bytes(), &response))
+
+	return response.Message
+}
+
+// twilioSignature signs the request to 'requestURL' with 'form' params, using the test twilio auth token
+func twilioSignature(requestURL string, form url.Values) string {
+	params := []string{}
+	for key, values := range form {
+		params = append(params, key+strings.Join(values, ","))
+	}
+	sort.Strings(params)
+
+	mac := hmac.New(sha1.New, []byte(TEST_TWILIO_AUTH_TOKEN))
+	mac.Write([]byte(requestURL + strings.Join(params, "")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestSmsAcknowledgement(t *testing.T) {
+	msgClient := setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "peter",
+		LastName:    "quill",
+		Email:       "starlord@guardians.com",
+		Password:    "awesome-mix",
+		PhoneNumber: "+17345678900",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	firstContact := &models.Contact{
+		FirstName:   "gamora",
+		LastName:    "zen-whoberi",
+		PhoneNumber: "+18345678900",
+		Email:       "gamora@guardians.com",
+	}
+	secondContact := &models.Contact{
+		FirstName:   "rocket",
+		LastName:    "raccoon",
+		PhoneNumber: "+19345678900",
+		Email:       "rocket@guardians.com",
+	}
+	assert.Nil(t, testUser.AddContact(firstContact))
+	assert.Nil(t, testUser.AddContact(secondContact))
+
+	err := testUser.SetEscalationPolicy([]models.EscalationStep{
+		{ContactID: firstContact.ID, DelayInMinutes: 0},
+		{ContactID: secondContact.ID, DelayInMinutes: 30},
+	})
+	assert.Nil(t, err)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	// The first step in the escalation chain was sent out
+	emergencyProbe, err := models.CreateEmergencyProbe(probe.ID, firstContact.ID, 0)
+	assert.Nil(t, err)
+
+	// Only a contact who was reached out to can acknowledge
+	assert.Empty(t, sendSms(t, "+10000000000", "ACK"))
+	assert.Empty(t, sendSms(t, secondContact.PhoneNumber, "ACK"))
+
+	emergencyProbe, err = models.FindEmergencyProbe(emergencyProbe.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, emergencyProbe.AcknowledgedAt)
+
+	assert.Contains(t, sendSms(t, firstContact.PhoneNumber, " ack "), "Thanks for acknowledging")
+
+	emergencyProbe, err = models.FindEmergencyProbe(emergencyProbe.ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, emergencyProbe.AcknowledgedAt)
+
+	// Nothing left to acknowledge
+	assert.Empty(t, sendSms(t, firstContact.PhoneNumber, "ACK"))
+
+	// The next step in the escalation chain becomes due after the acknowledgement
+	err = workerPool.PerformIn(1, work.JobParams{
+		Name:    "escalation-step-after-ack",
+		Handler: pbscheduler.SEND_ESCALATION_STEP_HANDLER,
+		Queue:   work.MESSAGES_QUEUE,
+		Args: map[string]interface{}{
+			"user_id":      testUser.ID,
+			"probe_id":     probe.ID,
+			"probe_status": models.BAD_PROBE,
+			"position":     1,
+		},
+	})
+	assert.Nil(t, err)
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	// The user is let know the first contact is on it
+	assert.Eventually(t, func() bool { return len(msgClient.MessagesTo(testUser.PhoneNumber)) == 1 },
+		10*time.Second, 100*time.Millisecond, "Expected user to be told a contact acknowledged")
+	assert.Contains(t, msgClient.MessagesTo(testUser.PhoneNumber)[0].Body, "Gamora")
+
+	stepDone := func() bool {
+		jobs, _, err := models.FetchJobsByStatus(models.SUCCESSFUL_JOB, 1)
+		assert.Nil(t, err)
+
+		for _, job := range jobs {
+			if job.Name == "escalation-step-after-ack" {
+				return true
+			}
+		}
+		return false
+	}
+	assert.Eventually(t, stepDone, 10*time.Second, 100*time.Millisecond, "Expected escalation step to run")
+
+	// The escalation chain stops once a contact acknowledges
+	assert.Len(t, msgClient.MessagesTo(secondContact.PhoneNumber), 0)
+	assert.Len(t, msgClient.MessagesTo(firstContact.PhoneNumber), 0, "Acknowledging contact should not be notified")
+}
+
+func TestSmsAcknowledgementExpires(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "stephen",
+		LastName:    "strange",
+		Email:       "strange@avengers.com",
+		Password:    "time-stone",
+		PhoneNumber: "+17345678905",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	contact := &models.Contact{
+		FirstName:   "wong",
+		LastName:    "kamar-taj",
+		PhoneNumber: "+18345678905",
+		Email:       "wong@kamar-taj.com",
+	}
+	assert.Nil(t, testUser.AddContact(contact))
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	emergencyProbe, err := models.CreateEmergencyProbe(probe.ID, contact.ID, 0)
+	assert.Nil(t, err)
+
+	// The emergency probe was sent out longer ago than its acknowledgement link is valid for
+	sentAt := time.Now().Add(-ACKNOWLEDGEMENT_LINK_TTL - time.Minute)
+	assert.Nil(t, emergencyProbe.Update(map[string]interface{}{"created_at": sentAt}))
+
+	assert.Empty(t, sendSms(t, contact.PhoneNumber, "ACK"))
+
+	emergencyProbe, err = models.FindEmergencyProbe(emergencyProbe.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, emergencyProbe.AcknowledgedAt, "An expired emergency probe should not be acknowledged")
+}
+
+func TestSmsDuressPin(t *testing.T) {
+	msgClient := setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "wanda",
+		LastName:    "maximoff",
+		Email:       "scarlet@avengers.com",
+		Password:    "chaos-magic",
+		PhoneNumber: "+13345678900",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	contact := &models.Contact{
+		FirstName:          "vision",
+		LastName:           "synthezoid",
+		PhoneNumber:        "+14345678900",
+		Email:              "vision@avengers.com",
+		IsEmergencyContact: true,
+	}
+	assert.Nil(t, testUser.AddContact(contact))
+	assert.Nil(t, testUser.SetProbePins("1234", "4321"))
+	assert.Nil(t, testUser.UpdateProbSettings(map[string]interface{}{"active": true}))
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	stream, unsubscribe := events.SubscribeChan(EVENT_STREAM_BUFFER_SIZE)
+	defer unsubscribe()
+
+	// The reply looks like the one for a 'good' probe
+	assert.Equal(t, "👍", sendSms(t, testUser.PhoneNumber, " 4321 "))
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	assert.Eventually(t, func() bool { return len(msgClient.MessagesTo(contact.PhoneNumber)) == 1 },
+		10*time.Second, 100*time.Millisecond, "Expected emergency contact to be reached out to")
+	assert.Contains(t, msgClient.MessagesTo(contact.PhoneNumber)[0].Body, "don't mention this message")
+
+	emergencyProbe, err := models.LastUnacknowledgedEmergencyProbe(contact.PhoneNumber, time.Now().Add(-ACKNOWLEDGEMENT_LINK_TTL))
+	assert.Nil(t, err)
+	assert.Contains(t, sendSms(t, contact.PhoneNumber, "ACK"), "Thanks for acknowledging")
+
+	noticeSent := func() bool {
+		jobs, _, err := models.FetchJobsByStatus(models.SUCCESSFUL_JOB, 1)
+		assert.Nil(t, err)
+
+		for _, job := range jobs {
+			if job.Name == pbscheduler.AcknowledgementNoticeName(emergencyProbe.ID) {
+				return true
+			}
+		}
+		return false
+	}
+	assert.Eventually(t, noticeSent, 10*time.Second, 100*time.Millisecond, "Expected acknowledgement notice job to run")
+
+	// Nothing lets on to anyone watching the user's phone or probes
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 0, "User should not be notified for a probe under duress")
+
+	probe, err = models.FindProbe(probe.ID)
+	assert.Nil(t, err)
+	assert.True(t, probe.Duress)
+
+	goodStatus, err := models.FindProbeStatus(models.GOOD_PROBE)
+	assert.Nil(t, err)
+	assert.Equal(t, goodStatus.ID, probe.ProbeStatusID, "Probe under duress should be recorded as 'good'")
+
+	probeSettings, err := models.FindProbeSettings(testUser.ID)
+	assert.Nil(t, err)
+	assert.True(t, probeSettings.Active, "User's probes should be left on")
+
+	publishedGood := false
+	for len(stream) > 0 {
+		event := <-stream
+		if event.UserID != testUser.ID {
+			continue
+		}
+
+		assert.NotEqual(t, events.PROBE_BAD, event.Type)
+		assert.NotEqual(t, events.EMERGENCY_SENT, event.Type)
+		publishedGood = publishedGood || event.Type == events.PROBE_GOOD
+	}
+	assert.True(t, publishedGood, "Expected 'probe.good' event to be published")
+}
+
+func TestSmsSafePinCancelsPayloadReleases(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "natasha",
+		LastName:    "romanoff",
+		Email:       "widow@avengers.com",
+		Password:    "red-room",
+		PhoneNumber: "+15345678900",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	contact := &models.Contact{
+		FirstName:   "clint",
+		LastName:    "barton",
+		PhoneNumber: "+16345678900",
+		Email:       "hawkeye@avengers.com",
+	}
+	assert.Nil(t, testUser.AddContact(contact))
+	assert.Nil(t, testUser.SetProbePins("1234", "4321"))
+
+	payload := &models.ReleasePayload{Name: "safe house", ContactID: contact.ID, Message: []byte("budapest")}
+	assert.Nil(t, testUser.AddReleasePayload(payload))
+
+	// The user failed to check in, so the payload is due to be released
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+	assert.Nil(t, models.SetProbeStatus(probe.ID, models.BAD_PROBE))
+
+	_, _, err = models.CreatePayloadRelease(payload, probe.ID, time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+
+	// A plain 'good' response isn't enough to cancel releases
+	assert.Empty(t, sendSms(t, testUser.PhoneNumber, "Yes"))
+
+	pendingReleases, err := testUser.FetchPendingPayloadReleases()
+	assert.Nil(t, err)
+	assert.Len(t, pendingReleases, 1)
+
+	assert.Contains(t, sendSms(t, testUser.PhoneNumber, "1234"), "Cancelled 1 pending release payload(s)")
+
+	pendingReleases, err = testUser.FetchPendingPayloadReleases()
+	assert.Nil(t, err)
+	assert.Len(t, pendingReleases, 0)
+}
+
+func TestCreateWebhookWithPrivateUrl(t *testing.T) {
+	setupTestServer(t)
+
+	for _, hookUrl := range []string{"http://127.0.0.1:3900/v1/jobs", "http://169.254.169.254/latest/meta-data"} {
+		body := strings.NewReader(`{"url": "` + hookUrl + `", "events": ["probe.good"]}`)
+
+		rw := httptest.NewRecorder()
+		createWebhookHandler(rw, httptest.NewRequest(http.MethodPost, "/v1/webhooks", body))
+		assert.Equal(t, http.StatusBadRequest, rw.Code, hookUrl)
+		assert.Contains(t, rw.Body.String(), "private, loopback or link-local")
+	}
+
+	webhooks, err := models.FetchWebhooks(nil)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 0)
+}
+
+func TestEventStreamEndsOnShutdown(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "peter",
+		LastName:    "parker",
+		Email:       "spidey@avengers.com",
+		Password:    "with-great-power",
+		PhoneNumber: "+17345678901",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	shuttingDown = make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), RequestContextKey("currentUser"), testUser)
+		eventStreamHandler(rw, r.WithContext(ctx))
+	}))
+	server.Config.RegisterOnShutdown(func() { close(shuttingDown) })
+	server.Start()
+
+	res, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, ": connected\n", line)
+
+	// The open stream shouldn't keep the server from shutting down
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, server.Config.Shutdown(ctx))
+}
+
+func TestPendingProbeResolvedOnlyOnce(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "bruce",
+		LastName:    "banner",
+		Email:       "hulk@avengers.com",
+		Password:    "always-angry",
+		PhoneNumber: "+17345678902",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	// e.g. the user replies by sms & uses the check-in link at the same time
+	smsReply, err := models.FindProbe(probe.ID)
+	assert.Nil(t, err)
+	checkIn, err := models.FindProbe(probe.ID)
+	assert.Nil(t, err)
+
+	checkIn.LastResponse = CheckInLinkResponses[models.GOOD_PROBE]
+	msg, err := resolvePendingProbe(checkIn, models.GOOD_PROBE)
+	assert.Nil(t, err)
+	assert.Equal(t, "👍", msg)
+
+	smsReply.LastResponse = "no"
+	response, err := probeReplyResponse(resolvePendingProbe(smsReply, models.BAD_PROBE))
+	assert.Nil(t, err)
+	assert.Equal(t, "<Response />", string(response))
+
+	goodStatus, err := models.FindProbeStatus(models.GOOD_PROBE)
+	assert.Nil(t, err)
+
+	probe, err = models.FindProbe(probe.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, goodStatus.ID, probe.ProbeStatusID)
+	assert.Equal(t, CheckInLinkResponses[models.GOOD_PROBE], probe.LastResponse)
+
+	jobs, _, err := models.FetchJobsByStatus(models.ENQUEUED_JOB, 1)
+	assert.Nil(t, err)
+	for _, job := range jobs {
+		assert.NotEqual(t, pbscheduler.EmergencyProbeName(testUser.ID), job.Name, "No emergency probe should be sent")
+	}
+
+	assert.ErrorIs(t, probe.Resolve(models.CANCELLED_PROBE), models.ErrProbeNotPending)
+}
+
+func TestCreateProbeWithoutEmergencyContact(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "scott",
+		LastName:    "lang",
+		Email:       "antman@avengers.com",
+		Password:    "quantum-realm",
+		PhoneNumber: "+17345678903",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/users/1/probes", strings.NewReader(""))
+	r = r.WithContext(context.WithValue(r.Context(), RequestContextKey("currentUser"), testUser))
+
+	rw := httptest.NewRecorder()
+	createProbeHandler(rw, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), "an emergency contact is required")
+}
+
+func TestDeleteUserRemovesPeriodicProbes(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "carol",
+		LastName:    "danvers",
+		Email:       "marvel@avengers.com",
+		Password:    "higher-further-faster",
+		PhoneNumber: "+17345678904",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	testUser.ProbeSettings.CronExpression = "0 0 18 * * 3"
+	assert.Nil(t, probeScheduler.PeriodicallyPerfomProbe(*testUser))
+
+	probeJobName := fmt.Sprintf("%v-%v", pbscheduler.SEND_LIVELINESS_PROBE_HANDLER, testUser.ID)
+	_, err := models.FindPeriodicJobByName(probeJobName)
+	assert.Nil(t, err, "The user's periodic probe should be saved")
+
+	r := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/users/%v", testUser.ID), nil)
+	r = r.WithContext(context.WithValue(r.Context(), RequestContextKey("userID"), fmt.Sprint(testUser.ID)))
+
+	rw := httptest.NewRecorder()
+	deleteUserHandler(rw, r)
+	assert.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+	_, err = models.FindPeriodicJobByName(probeJobName)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "The user's periodic probe should be removed")
+
+	_, err = models.FindUserBy("ID", testUser.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = models.FindProbeSettings(testUser.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "The user's probe settings should be deleted with them")
+}
+
+func TestUpdateProbePins(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "natasha",
+		LastName:    "romanova",
+		Email:       "black-widow@avengers.com",
+		Password:    "red-room",
+		PhoneNumber: "+17345678906",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	testCases := []struct {
+		desc              string
+		body              string
+		expectedStatus    int
+		expectedSafePin   bool
+		expectedDuressPin bool
+	}{
+		{"set both pins", `{"safe_pin": "2580", "duress_pin": "0852"}`, http.StatusOK, true, true},
+		{"update only the safe pin", `{"safe_pin": "1470"}`, http.StatusOK, true, true},
+		{"duress pin matching the safe pin", `{"duress_pin": "1470"}`, http.StatusBadRequest, true, true},
+		{"set & clear the same pin", `{"duress_pin": "3690", "clear_duress_pin": true}`, http.StatusBadRequest, true, true},
+		{"clear the duress pin", `{"clear_duress_pin": true}`, http.StatusOK, true, false},
+		{"update the duress pin", `{"duress_pin": "3690"}`, http.StatusOK, true, true},
+		{"clear the safe pin", `{"clear_safe_pin": true}`, http.StatusOK, false, true},
+	}
+
+	for _, tcase := range testCases {
+		t.Run(tcase.desc, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/v1/users/1/probe_pins", strings.NewReader(tcase.body))
+			r = r.WithContext(context.WithValue(r.Context(), RequestContextKey("currentUser"), testUser))
+
+			rw := httptest.NewRecorder()
+			updateProbePinsHandler(rw, r)
+			assert.Equal(t, tcase.expectedStatus, rw.Code, rw.Body.String())
+
+			user, err := models.FindUserBy("ID", testUser.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, tcase.expectedSafePin, user.ProbeSettings.HasPin(models.SAFE_PIN))
+			assert.Equal(t, tcase.expectedDuressPin, user.ProbeSettings.HasPin(models.DURESS_PIN))
+		})
+	}
+
+	user, err := models.FindUserBy("ID", testUser.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, models.DURESS_PIN, user.ProbeSettings.MatchPin("3690"))
+}
+
+func TestCreateReleasePayloadWithAttachmentsWithoutEmail(t *testing.T) {
+	setupTestServer(t)
+
+	testUser := &models.User{
+		FirstName:   "thor",
+		LastName:    "odinson",
+		Email:       "thor@avengers.com",
+		Password:    "mjolnir",
+		PhoneNumber: "+17345678907",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	body := `{"name": "asgard", "contact_id": 1, "message": "New Asgard is in Norway",
+		"attachments": [{"file_name": "map.txt", "content": "Z28gbm9ydGg="}]}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/users/1/release_payloads", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), RequestContextKey("currentUser"), testUser))
+
+	rw := httptest.NewRecorder()
+	createReleasePayloadHandler(rw, r)
+	assert.Equal(t, http.StatusUnprocessableEntity, rw.Code, rw.Body.String())
+	assert.Contains(t, rw.Body.String(), "email isn't enabled")
+}
+
+func TestFetchJobsWithInvalidStatus(t *testing.T) {
+	setupTestServer(t)
+
+	rw := httptest.NewRecorder()
+	fetchJobsHandler(rw, httptest.NewRequest(http.MethodGet, "/v1/jobs?status=unknown", nil))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	for status := range models.JobStatusNameMap {
+		assert.Contains(t, rw.Body.String(), status)
+	}
+}
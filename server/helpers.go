@@ -11,14 +11,17 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Daskott/kronus/server/auth"
+	"github.com/Daskott/kronus/server/events"
 	"github.com/Daskott/kronus/server/models"
 	"github.com/Daskott/kronus/server/pbscheduler"
 	"github.com/Daskott/kronus/server/work"
+	"github.com/Daskott/kronus/shared"
 	"github.com/Daskott/kronus/utils"
 	"github.com/go-co-op/gocron"
 	"github.com/go-playground/validator"
@@ -69,6 +72,22 @@ func removeUnknownFields(args map[string]interface{}, validFields map[string]boo
 	}
 }
 
+// listNames returns the keys in 'names' sorted & listed in a sentence i.e. "a, b or c"
+func listNames(names map[string]bool) string {
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	if len(sortedNames) < 2 {
+		return strings.Join(sortedNames, "")
+	}
+
+	last := len(sortedNames) - 1
+	return strings.Join(sortedNames[:last], ", ") + " or " + sortedNames[last]
+}
+
 func RegisterValidators(validate *validator.Validate) error {
 	err := validate.RegisterValidation("password", func(fl validator.FieldLevel) bool {
 		// if whitespace in password return false
@@ -110,6 +129,13 @@ func RegisterValidators(validate *validator.Validate) error {
 		return err
 	}
 
+	err = validate.RegisterValidation("webhook_event", func(fl validator.FieldLevel) bool {
+		return events.IsValidType(fl.Field().String())
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -141,7 +167,8 @@ func decodeAndVerifyAuthHeader(authHeaderValue string) DecodedJWT {
 // who can GET/DELETE certain user resources
 func canAccessUserResource(r *http.Request, userClaims *auth.KronusTokenClaims) bool {
 	allowedMethodsForAdmins := map[string]bool{"GET": true, "DELETE": true}
-	deniedPathsForAdmin := []string{"/contacts"}
+	deniedPathsForAdmin := []string{"/contacts", "/escalation_policy", "/probe_pins", "/snooze", "/probe_schedules",
+		"/release_payloads", "/payload_releases", "/webhooks"}
 
 	if mux.Vars(r)["uid"] == userClaims.Subject {
 		return true
@@ -169,10 +196,123 @@ func isValidCronExpression(expression string) bool {
 	return err == nil
 }
 
+// isValidTimeZone returns true for a time zone like 'America/Toronto', or an empty string which uses the server's time zone
+func isValidTimeZone(value interface{}) bool {
+	timeZone, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	if timeZone == "" {
+		return true
+	}
+
+	_, err := time.LoadLocation(timeZone)
+	return err == nil
+}
+
+// isValidQuietHoursTime returns true for a time like '22:00', or '' which removes quiet hours
+func isValidQuietHoursTime(value interface{}) bool {
+	timeStr, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	if timeStr == "" {
+		return true
+	}
+
+	_, err := time.Parse(models.QUIET_HOURS_LAYOUT, timeStr)
+	return err == nil
+}
+
+// requireEscalationChain writes a 403 response & returns false, if the user has no emergency contact
+// or escalation policy, which are required to enable liveliness probes
+func requireEscalationChain(rw http.ResponseWriter, user *models.User) bool {
+	steps, err := user.EscalationChain()
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return false
+	}
+
+	if len(steps) == 0 {
+		writeResponse(rw, ResponsePayload{Errors: []string{
+			"an emergency contact is required to enable liveliness probe i.e 'active = true'"}}, http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// rescheduleActiveProbeSchedules reschedules the user's active probe schedules e.g. after their time zone changes
+func rescheduleActiveProbeSchedules(user *models.User) error {
+	schedules, err := user.FetchProbeSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if !schedule.Active {
+			continue
+		}
+
+		err = probeScheduler.PeriodicallyPerformProbeSchedule(*user, schedule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // ---------------------------------------------------------------------------------//
 // Server Helper functions
 // --------------------------------------------------------------------------------//
 
+// workerQueues returns the no. of workers for each named queue, from the workers config
+func workerQueues(workersConfig shared.WorkersConfig) map[string]int {
+	queues := make(map[string]int)
+	for queue, concurrency := range workersConfig.Queues {
+		queues[queue] = concurrency
+	}
+
+	if workersConfig.Concurrency > 0 {
+		queues[work.DEFAULT_QUEUE] = workersConfig.Concurrency
+	}
+
+	return queues
+}
+
+// retentionCutoff returns the time before which jobs kept for 'days' are deleted.
+// A zero time is returned if 'days' is 0 i.e. the jobs are kept forever.
+func retentionCutoff(days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().AddDate(0, 0, -days)
+}
+
+// writePeriodicJobResponse writes the response for an admin action on 'periodicJob', or the 'err' it failed with
+func writePeriodicJobResponse(rw http.ResponseWriter, periodicJob *models.PeriodicJob, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"periodic job not found"}}, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, work.ErrUnknownHandler) {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: periodicJob}, http.StatusOK)
+}
+
 func serve(server *http.Server) {
 	logg.Infof("Kronus server is listening on port:%v", server.Addr)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -186,7 +326,7 @@ func cleanup(workerPool *work.WorkerPoolAdapter, server *http.Server, backupDb b
 	workerPool.Stop()
 
 	if backupDb {
-		backupSqliteDb(nil)
+		backupSqliteDb(context.Background(), nil)
 	}
 
 	// Shutdown server gracefully
@@ -248,9 +388,21 @@ func handleProbeMsgReply(user models.User, message string) ([]byte, error) {
 		return nil, err
 	}
 
-	// If no pending probe - do nothing
+	// If no pending probe - the user may be checking in after an emergency probe was sent out
 	if !pendingProbe {
-		return []byte("<Response />"), nil
+		return cancelPayloadReleasesOnCheckIn(user, message)
+	}
+
+	// Pins are checked first, and never saved as the probe's 'LastResponse'
+	if user.ProbeSettings != nil {
+		switch user.ProbeSettings.MatchPin(message) {
+		case models.SAFE_PIN:
+			probe.LastResponse = PIN_RESPONSE
+			return probeReplyResponse(resolvePendingProbe(probe, models.GOOD_PROBE))
+		case models.DURESS_PIN:
+			probe.LastResponse = PIN_RESPONSE
+			return probeReplyResponse(resolvePendingProbeUnderDuress(probe))
+		}
 	}
 
 	// Determine if user probe was 'good' or 'bad' from their reply i.e. message
@@ -259,17 +411,155 @@ func handleProbeMsgReply(user models.User, message string) ([]byte, error) {
 
 	// if unable to determine probe status from msg - save 'LastResponse' & do nothing
 	if probeStatusName == "" {
-		probe.Save()
+		probe.Update(map[string]interface{}{"last_response": message})
+		return []byte("<Response />"), nil
+	}
+
+	return probeReplyResponse(resolvePendingProbe(probe, probeStatusName))
+}
+
+// probeReplyResponse returns the sms response with 'msg', for a reply to a pending probe.
+// If the probe was resolved in the meantime e.g. via its check-in link, nothing is sent back.
+func probeReplyResponse(msg string, err error) ([]byte, error) {
+	if errors.Is(err, models.ErrProbeNotPending) {
+		return []byte("<Response />"), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return xml.Marshal(&TwilioSmsResponse{Message: msg})
+}
+
+// webhookOwnerID returns the ID of the user whose webhooks are being managed,
+// or nil for the admin routes, which manage the webhooks for all users
+func webhookOwnerID(r *http.Request) *uint {
+	if mux.Vars(r)["uid"] == "" {
+		return nil
+	}
+
+	currentUser := r.Context().Value(RequestContextKey("currentUser")).(*models.User)
+	return &currentUser.ID
+}
+
+// webhookEventsFromParam returns the webhook events in the 'events' param of a request,
+// and false if it isn't a list of one or more valid event types
+func webhookEventsFromParam(param interface{}) (models.WebhookEvents, bool) {
+	list, ok := param.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+
+	webhookEvents := models.WebhookEvents{}
+	for _, item := range list {
+		eventType, ok := item.(string)
+		if !ok || !events.IsValidType(eventType) {
+			return nil, false
+		}
+		webhookEvents = append(webhookEvents, eventType)
+	}
+
+	return webhookEvents, true
+}
+
+// cancelPayloadReleasesOnCheckIn cancels the user's pending payload releases, if they reply
+// with their safe pin. Otherwise it does nothing i.e. a plain 'good' response isn't enough,
+// since anyone with the user's phone could send it.
+func cancelPayloadReleasesOnCheckIn(user models.User, message string) ([]byte, error) {
+	if user.ProbeSettings == nil || user.ProbeSettings.MatchPin(message) != models.SAFE_PIN {
+		return []byte("<Response />"), nil
+	}
+
+	cancelled, err := user.CancelPendingPayloadReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	if cancelled == 0 {
 		return []byte("<Response />"), nil
 	}
 
-	probeStatus, err := models.FindProbeStatus(probeStatusName)
+	return xml.Marshal(&TwilioSmsResponse{
+		Message: fmt.Sprintf("Glad you're okay! Cancelled %v pending release payload(s).", cancelled),
+	})
+}
+
+// encryptReleasePayload encrypts the message & attachments of the 'newPayload' sent by the user
+func encryptReleasePayload(newPayload NewReleasePayload) (*models.ReleasePayload, error) {
+	cipher := payloadCipher{}
+
+	message, err := cipher.Encrypt([]byte(newPayload.Message))
 	if err != nil {
 		return nil, err
 	}
 
-	probe.ProbeStatusID = probeStatus.ID
-	probe.Save()
+	payload := models.ReleasePayload{
+		Name:           newPayload.Name,
+		ContactID:      newPayload.ContactID,
+		Message:        message,
+		DelayInMinutes: newPayload.DelayInMinutes,
+		Attachments:    []models.ReleasePayloadAttachment{},
+	}
+
+	for _, attachment := range newPayload.Attachments {
+		content, err := cipher.Encrypt(attachment.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		payload.Attachments = append(payload.Attachments, models.ReleasePayloadAttachment{
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			Size:        len(attachment.Content),
+			Content:     content,
+		})
+	}
+
+	return &payload, nil
+}
+
+// findPendingProbe returns the user's probe with 'id'. If the probe doesn't exist or isn't pending,
+// an error response is written & false is returned.
+func findPendingProbe(rw http.ResponseWriter, user *models.User, id string) (*models.Probe, bool) {
+	probe, err := user.FindProbe(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeResponse(rw, ResponsePayload{Errors: []string{"probe not found"}}, http.StatusNotFound)
+		return nil, false
+	}
+
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if probe.ProbeStatus == nil || probe.ProbeStatus.Name != models.PENDING_PROBE {
+		writeResponse(rw, ResponsePayload{Errors: []string{"only a pending probe can be updated"}}, http.StatusConflict)
+		return nil, false
+	}
+
+	return probe, true
+}
+
+// writeProbeResponse writes the user's probe with 'probeID' as the response, with its latest status
+func writeProbeResponse(rw http.ResponseWriter, user *models.User, probeID uint) {
+	probe, err := user.FindProbe(probeID)
+	if err != nil {
+		writeResponse(rw, ResponsePayload{Errors: []string{err.Error()}}, http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(rw, ResponsePayload{Success: true, Data: probe}, http.StatusOK)
+}
+
+// resolvePendingProbe sets the status of a pending probe to 'probeStatusName' i.e. 'good' or 'bad'.
+// For a 'bad' probe, a job is enqueued to reach out to the user's emergency contact.
+// It returns the message to send back to the user.
+func resolvePendingProbe(probe *models.Probe, probeStatusName string) (string, error) {
+	err := probe.Resolve(probeStatusName)
+	if err != nil {
+		return "", err
+	}
 
 	msg := "👍"
 	if probeStatusName == models.BAD_PROBE {
@@ -279,6 +569,7 @@ func handleProbeMsgReply(user models.User, message string) ([]byte, error) {
 		err = workerPool.Perform(work.JobParams{
 			Name:    pbscheduler.EmergencyProbeName(probe.UserID),
 			Handler: pbscheduler.SEND_EMERGENCY_PROBE_HANDLER,
+			Queue:   work.MESSAGES_QUEUE,
 			Args: map[string]interface{}{
 				"user_id":      probe.UserID,
 				"probe_id":     probe.ID,
@@ -287,11 +578,39 @@ func handleProbeMsgReply(user models.User, message string) ([]byte, error) {
 		})
 
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 	}
 
-	return xml.Marshal(&TwilioSmsResponse{Message: msg})
+	return msg, nil
+}
+
+// resolvePendingProbeUnderDuress sets the status of a pending probe to 'good' & enqueues a job to silently reach
+// out to the user's emergency contact, for a user who responded with their duress pin.
+// The probe, its events & the message returned look like any other 'good' probe's,
+// so anyone watching the user's phone or probes is none the wiser.
+func resolvePendingProbeUnderDuress(probe *models.Probe) (string, error) {
+	probe.Duress = true
+	err := probe.Resolve(models.GOOD_PROBE)
+	if err != nil {
+		return "", err
+	}
+
+	err = workerPool.Perform(work.JobParams{
+		Name:    pbscheduler.EmergencyProbeName(probe.UserID),
+		Handler: pbscheduler.SEND_EMERGENCY_PROBE_HANDLER,
+		Queue:   work.MESSAGES_QUEUE,
+		Args: map[string]interface{}{
+			"user_id":      probe.UserID,
+			"probe_id":     probe.ID,
+			"probe_status": models.BAD_PROBE,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "👍", nil
 }
 
 func handlePingCmd(input string) ([]byte, error) {
@@ -324,31 +643,105 @@ func handleDynamicProbeCmd(user *models.User, input string) ([]byte, error) {
 		return xml.Marshal(&TwilioSmsResponse{Message: outputBuffer.String()})
 	}
 
-	if _, err := user.EmergencyContact(); err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return xml.Marshal(&TwilioSmsResponse{Message: "An emergency contact is required to use the 'probe' cmd"})
-		}
+	steps, err := user.EscalationChain()
+	if err != nil {
 		return []byte{}, err
 	}
 
-	err = workerPool.PerformIn(*inPtr*60, work.JobParams{
+	if len(steps) == 0 {
+		return xml.Marshal(&TwilioSmsResponse{Message: "An emergency contact is required to use the 'probe' cmd"})
+	}
+
+	err = scheduleDynamicProbe(user, DynamicProbePayload{
+		DelayInMinutes:    *inPtr,
+		MaxRetries:        *retriesPtr,
+		WaitTimeInMinutes: *waitPtr,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return xml.Marshal(&TwilioSmsResponse{Message: fmt.Sprintf(
+		"👍. Will check on you in %v minutes & retry %v time(s) if no response, "+
+			"before reaching out to your emergency contact.", *inPtr, *retriesPtr)})
+}
+
+// scheduleDynamicProbe enqueues a one-off probe for the user, to be sent 'DelayInMinutes' from now
+func scheduleDynamicProbe(user *models.User, dynamicProbe DynamicProbePayload) error {
+	return workerPool.PerformIn(dynamicProbe.DelayInMinutes*60, work.JobParams{
 		Name:    pbscheduler.SEND_DYNAMIC_PROBE_HANDLER,
 		Handler: pbscheduler.SEND_DYNAMIC_PROBE_HANDLER,
+		Queue:   work.MESSAGES_QUEUE,
 		Args: map[string]interface{}{
 			"first_name":           user.FirstName,
 			"last_name":            user.LastName,
 			"user_id":              user.ID,
-			"max_retries":          *retriesPtr,
-			"wait_time_in_minutes": *waitPtr,
+			"max_retries":          dynamicProbe.MaxRetries,
+			"wait_time_in_minutes": dynamicProbe.WaitTimeInMinutes,
 		},
 	})
+}
+
+func handleSnoozeCmd(user *models.User, input string) ([]byte, error) {
+	var err error
+	outputBuffer := new(bytes.Buffer)
+
+	snoozeCmd := flag.NewFlagSet("snooze", flag.ContinueOnError)
+	snoozeCmd.SetOutput(outputBuffer)
+
+	hoursPtr := snoozeCmd.Int("hours", 0, "No. of hours to snooze probes for")
+	daysPtr := snoozeCmd.Int("days", 0, "No. of days to snooze probes for")
+	untilPtr := snoozeCmd.String("until", "", "Snooze probes until e.g. 2022-01-14T09:00")
+	offPtr := snoozeCmd.Bool("off", false, "Turn off snooze")
+
+	// Parse Arguments without the name of command
+	err = snoozeCmd.Parse(strings.Split(input, " ")[1:])
+	if err != nil {
+		return xml.Marshal(&TwilioSmsResponse{Message: outputBuffer.String()})
+	}
+
+	if *offPtr {
+		err = probeScheduler.LiftSnooze(user)
+		if err != nil {
+			return nil, err
+		}
+
+		return xml.Marshal(&TwilioSmsResponse{Message: "👍. Snooze is off."})
+	}
+
+	startsAt := time.Now()
+	endsAt := startsAt.Add(time.Duration(*hoursPtr)*time.Hour + time.Duration(*daysPtr)*24*time.Hour)
+	if *untilPtr != "" {
+		endsAt, err = time.ParseInLocation(SNOOZE_CMD_TIME_LAYOUT, *untilPtr, probeScheduler.UserLocation(user))
+		if err != nil {
+			return xml.Marshal(&TwilioSmsResponse{Message: "'until' must be a valid time e.g. 2022-01-14T09:00"})
+		}
+	}
+
+	if errMsg := validateSnoozeWindow(startsAt, endsAt); errMsg != "" {
+		return xml.Marshal(&TwilioSmsResponse{Message: errMsg})
+	}
+
+	err = probeScheduler.Snooze(user, startsAt, endsAt)
 	if err != nil {
 		return nil, err
 	}
 
 	return xml.Marshal(&TwilioSmsResponse{Message: fmt.Sprintf(
-		"👍. Will check on you in %v minutes & retry %v time(s) if no response, "+
-			"before reaching out to your emergency contact.", *inPtr, *retriesPtr)})
+		"👍. Probes snoozed until %v.", endsAt.In(probeScheduler.UserLocation(user)).Format(SNOOZE_CMD_TIME_LAYOUT))})
+}
+
+// validateSnoozeWindow returns an error message if the snooze window is invalid, otherwise ''
+func validateSnoozeWindow(startsAt, endsAt time.Time) string {
+	if !endsAt.After(time.Now()) || !endsAt.After(startsAt) {
+		return "snooze must end in the future, after it starts"
+	}
+
+	if endsAt.Sub(startsAt) > MAX_SNOOZE_DURATION {
+		return fmt.Sprintf("snooze can't be longer than %v days", int(MAX_SNOOZE_DURATION.Hours()/24))
+	}
+
+	return ""
 }
 
 func handleHelpCmd(input string) ([]byte, error) {
@@ -369,8 +762,185 @@ Available Commands:
 
   probe   Ask kronus to check on you in a couple minutes
 
+  snooze  Pause liveliness probes for a while
+
   ping    Health check for the server
 
 Use "[command] --help" for more information about a command.`
 	return xml.Marshal(&TwilioSmsResponse{Message: res})
 }
+
+// ---------------------------------------------------------------------------------//
+// Check-in Helper functions
+// --------------------------------------------------------------------------------//
+
+// signedLinker builds signed links to kronus pages, which expire
+type signedLinker struct{}
+
+// CheckInLink returns the signed url a user can visit to respond to the probe with 'probeID'
+func (signedLinker) CheckInLink(probeID uint) string {
+	token := auth.EncodeLinkToken(auth.CHECK_IN_LINK_TOKEN, probeID, time.Now().Add(CHECK_IN_LINK_TTL), authKeyPair)
+	return fmt.Sprintf("%v/c/%v", strings.TrimSuffix(config.Kronus.PublicUrl, "/"), token)
+}
+
+// AcknowledgementLink returns the signed url a contact can visit to acknowledge the emergency probe
+func (signedLinker) AcknowledgementLink(emergencyProbeID uint) string {
+	token := auth.EncodeLinkToken(auth.ACKNOWLEDGEMENT_LINK_TOKEN, emergencyProbeID,
+		time.Now().Add(ACKNOWLEDGEMENT_LINK_TTL), authKeyPair)
+	return fmt.Sprintf("%v/a/%v", strings.TrimSuffix(config.Kronus.PublicUrl, "/"), token)
+}
+
+// payloadCipher encrypts & decrypts release payloads, with a key derived from the server's private key.
+// Rotating the private key makes any stored payload unreadable.
+type payloadCipher struct{}
+
+func (payloadCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	return auth.Encrypt(auth.RELEASE_PAYLOAD_ENCRYPTION, plaintext, authKeyPair)
+}
+
+func (payloadCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return auth.Decrypt(auth.RELEASE_PAYLOAD_ENCRYPTION, ciphertext, authKeyPair)
+}
+
+// pendingProbeFromCheckInToken returns the pending probe the check-in 'token' was created for.
+// If the probe is no longer pending, 'ErrInvalidLinkToken' is returned i.e. each link can only be used once.
+func pendingProbeFromCheckInToken(token string) (*models.Probe, error) {
+	probeID, err := auth.DecodeLinkToken(auth.CHECK_IN_LINK_TOKEN, token, authKeyPair)
+	if err != nil {
+		return nil, err
+	}
+
+	probe, err := models.FindProbe(probeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, auth.ErrInvalidLinkToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	isPending, err := probe.IsPending()
+	if err != nil {
+		return nil, err
+	}
+
+	if !isPending {
+		return nil, auth.ErrInvalidLinkToken
+	}
+
+	return probe, nil
+}
+
+func checkInPage(token, message string) LinkPage {
+	return LinkPage{
+		Title:   CHECK_IN_PAGE_TITLE,
+		Message: message,
+		Action:  "/c/" + token,
+		Buttons: []LinkPageButton{
+			{Value: models.GOOD_PROBE, Label: CheckInLinkResponses[models.GOOD_PROBE]},
+			{Value: models.BAD_PROBE, Label: CheckInLinkResponses[models.BAD_PROBE]},
+		},
+	}
+}
+
+func writeLinkPage(rw http.ResponseWriter, page LinkPage, statusCode int) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(statusCode)
+
+	if err := linkPageTemplate.Execute(rw, page); err != nil {
+		logg.Error(err)
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		logg.Error(page.Message)
+	}
+}
+
+// ---------------------------------------------------------------------------------//
+// Acknowledgement Helper functions
+// --------------------------------------------------------------------------------//
+
+// emergencyProbeFromAcknowledgementToken returns the emergency probe the acknowledgement 'token' was created for
+func emergencyProbeFromAcknowledgementToken(token string) (*models.EmergencyProbe, error) {
+	emergencyProbeID, err := auth.DecodeLinkToken(auth.ACKNOWLEDGEMENT_LINK_TOKEN, token, authKeyPair)
+	if err != nil {
+		return nil, err
+	}
+
+	emergencyProbe, err := models.FindEmergencyProbe(emergencyProbeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, auth.ErrInvalidLinkToken
+	}
+
+	return emergencyProbe, err
+}
+
+// acknowledgeEmergencyProbe marks the emergency probe as acknowledged by its contact, which stops
+// further escalation, and enqueues a job to let the user & other contacts know.
+// It returns the message to send back to the contact.
+func acknowledgeEmergencyProbe(emergencyProbe *models.EmergencyProbe) (string, error) {
+	acknowledgement, err := models.ProbeAcknowledgement(emergencyProbe.ProbeID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+
+	// Only the first acknowledgement counts
+	if acknowledgement != nil {
+		if acknowledgement.ID == emergencyProbe.ID {
+			return "You've already acknowledged this alert.", nil
+		}
+
+		return fmt.Sprintf("Thanks! %v already got the alert and is reaching out.",
+			strings.Title(acknowledgement.Contact.FirstName)), nil
+	}
+
+	acknowledged, err := emergencyProbe.Acknowledge()
+	if err != nil {
+		return "", err
+	}
+
+	if !acknowledged {
+		return "You've already acknowledged this alert.", nil
+	}
+
+	probe, err := models.FindProbe(emergencyProbe.ProbeID)
+	if err != nil {
+		return "", err
+	}
+
+	err = workerPool.Perform(work.JobParams{
+		Name:    pbscheduler.AcknowledgementNoticeName(emergencyProbe.ID),
+		Handler: pbscheduler.SEND_ACKNOWLEDGEMENT_NOTICE_HANDLER,
+		Queue:   work.MESSAGES_QUEUE,
+		Args: map[string]interface{}{
+			"user_id":            probe.UserID,
+			"emergency_probe_id": emergencyProbe.ID,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "Thanks for acknowledging! We'll let everyone know you're on it.", nil
+}
+
+func handleAckCmd(from string) ([]byte, error) {
+	// Like the acknowledgement link, an emergency probe can only be acknowledged for so long
+	emergencyProbe, err := models.LastUnacknowledgedEmergencyProbe(from, time.Now().Add(-ACKNOWLEDGEMENT_LINK_TTL))
+
+	// No need to send response if there's nothing to acknowledge
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []byte("<Response />"), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := acknowledgeEmergencyProbe(emergencyProbe)
+	if err != nil {
+		return nil, err
+	}
+
+	return xml.Marshal(&TwilioSmsResponse{Message: msg})
+}
@@ -1,14 +1,16 @@
 package server
 
 import (
+	"context"
 	"path/filepath"
+	"time"
 
 	"github.com/Daskott/kronus/server/models"
 	"github.com/Daskott/kronus/server/work"
 	"github.com/Daskott/kronus/utils"
 )
 
-func backupSqliteDb(map[string]interface{}) error {
+func backupSqliteDb(ctx context.Context, args map[string]interface{}) error {
 	logg.Info("Backing up Sqlite db...")
 
 	dbDir, err := models.DbDirectory(configDir)
@@ -19,7 +21,7 @@ func backupSqliteDb(map[string]interface{}) error {
 	// Upload db file
 	file := filepath.Join(dbDir, models.DB_NAME)
 	if utils.FileExist(file) {
-		err = storage.UploadFile(file)
+		err = storage.UploadFileWithContext(ctx, file)
 		if err != nil {
 			return err
 		}
@@ -28,7 +30,7 @@ func backupSqliteDb(map[string]interface{}) error {
 	// Upload db shm file
 	file = filepath.Join(dbDir, models.DB_NAME+"-shm")
 	if utils.FileExist(file) {
-		err = storage.UploadFile(file)
+		err = storage.UploadFileWithContext(ctx, file)
 		if err != nil {
 			return err
 		}
@@ -37,7 +39,7 @@ func backupSqliteDb(map[string]interface{}) error {
 	// Upload db wal file
 	file = filepath.Join(dbDir, models.DB_NAME+"-wal")
 	if utils.FileExist(file) {
-		err = storage.UploadFile(file)
+		err = storage.UploadFileWithContext(ctx, file)
 		if err != nil {
 			return err
 		}
@@ -47,19 +49,61 @@ func backupSqliteDb(map[string]interface{}) error {
 	return nil
 }
 
+// pruneJobs deletes 'successful' & 'dead' jobs older than the no. of days they're kept for
+func pruneJobs(ctx context.Context, args map[string]interface{}) error {
+	logg.Info("Pruning jobs...")
+
+	retention := config.Kronus.Workers.Retention
+	pruning, err := models.PruneJobs(
+		retentionCutoff(retention.SuccessfulJobsInDays),
+		retentionCutoff(retention.DeadJobsInDays),
+	)
+	if err != nil {
+		return err
+	}
+
+	logg.Infof("Pruned %v successful job(s) & %v dead job(s)", pruning.SuccessfulJobCount, pruning.DeadJobCount)
+	return nil
+}
+
 func registerJobHandlers(wpa *work.WorkerPoolAdapter) {
-	wpa.Register("backupSqliteDb", backupSqliteDb)
+	wpa.RegisterContext("backupSqliteDb", backupSqliteDb, work.HandlerOptions{Timeout: 3 * time.Minute})
+	wpa.RegisterContext("pruneJobs", pruneJobs, work.HandlerOptions{Timeout: 3 * time.Minute})
 }
 
-func enqueueJobs(wpa *work.WorkerPoolAdapter) {
+// enqueueJobs schedules the server's periodic jobs that are turned on, & removes the ones turned off
+func enqueueJobs(wpa *work.WorkerPoolAdapter) error {
 	if enabled, ok := config.Google.Storage.EnableSqliteBackupAndSync.(bool); ok && enabled {
-		wpa.PeriodicallyPerform(config.Google.Storage.SqliteBackupSchedule,
+		err := wpa.PeriodicallyPerform(config.Google.Storage.SqliteBackupSchedule,
 			work.JobParams{
-				Name:    "backupSqliteDb",
-				Handler: "backupSqliteDb",
-				Args:    map[string]interface{}{},
+				Name:     "backupSqliteDb",
+				Handler:  "backupSqliteDb",
+				Queue:    work.MAINTENANCE_QUEUE,
+				Priority: work.LOW_PRIORITY,
+				Args:     map[string]interface{}{},
 			})
+		if err != nil {
+			return err
+		}
 	} else {
+		// Remove the backup job saved in the db, if backups were turned on before
+		wpa.RemovePeriodicJob("backupSqliteDb")
 		logg.Info("Sqlite db backup turned off")
 	}
+
+	retention := config.Kronus.Workers.Retention
+	if retention.SuccessfulJobsInDays > 0 || retention.DeadJobsInDays > 0 {
+		return wpa.PeriodicallyPerform(retention.PruneSchedule,
+			work.JobParams{
+				Name:     "pruneJobs",
+				Handler:  "pruneJobs",
+				Queue:    work.MAINTENANCE_QUEUE,
+				Priority: work.LOW_PRIORITY,
+				Args:     map[string]interface{}{},
+			})
+	}
+
+	wpa.RemovePeriodicJob("pruneJobs")
+	logg.Info("Job pruning turned off")
+	return nil
 }
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Daskott/kronus/server/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// The queue jobs created by these tests are added to, so they're never picked up by a worker
+const TEST_PRUNING_QUEUE = "pruning"
+
+func TestPruneJobs(t *testing.T) {
+	setupTestServer(t)
+
+	now := time.Now()
+	successfulBefore := now.AddDate(0, 0, -7)
+	deadBefore := now.AddDate(0, 0, -30)
+
+	testCases := []struct {
+		name      string
+		status    string
+		updatedAt time.Time
+		pruned    bool
+	}{
+		{"successful_before_retention", models.SUCCESSFUL_JOB, successfulBefore.Add(-time.Second), true},
+		{"successful_at_retention", models.SUCCESSFUL_JOB, successfulBefore, false},
+		{"successful_within_retention", models.SUCCESSFUL_JOB, successfulBefore.Add(time.Second), false},
+		{"dead_before_retention", models.DEAD_JOB, deadBefore.Add(-time.Second), true},
+		{"dead_at_retention", models.DEAD_JOB, deadBefore, false},
+		// Dead jobs are kept for longer than successful ones, so this one is only past the successful jobs' retention
+		{"dead_within_retention", models.DEAD_JOB, successfulBefore.Add(-time.Hour), false},
+		{"enqueued", models.ENQUEUED_JOB, now.AddDate(-1, 0, 0), false},
+		{"in_progress", models.IN_PROGRESS_JOB, now.AddDate(-1, 0, 0), false},
+		{"scheduled", models.SCHEDULED_JOB, now.AddDate(-1, 0, 0), false},
+	}
+
+	jobs := make([]*models.Job, len(testCases))
+	for i, tcase := range testCases {
+		jobs[i] = createJobWithStatus(t, "pruning-"+tcase.name, tcase.status, tcase.updatedAt)
+	}
+	defer deleteJobs(t, jobs)
+
+	pruning, err := models.PruneJobs(successfulBefore, deadBefore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), pruning.SuccessfulJobCount)
+	assert.Equal(t, int64(1), pruning.DeadJobCount)
+
+	for i, tcase := range testCases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := models.FindJob(jobs[i].ID)
+			attempts, _, attemptsErr := models.FetchJobAttempts(jobs[i].ID, 1)
+			assert.Nil(t, attemptsErr)
+
+			if tcase.pruned {
+				assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "Job should be pruned")
+				assert.Empty(t, attempts, "Job's attempts should be pruned with it")
+				return
+			}
+
+			assert.Nil(t, err, "Job should be kept")
+			assert.Len(t, attempts, 1, "Job's attempts should be kept")
+		})
+	}
+}
+
+func TestPruneJobsKeepsJobsWithoutRetention(t *testing.T) {
+	setupTestServer(t)
+
+	yearAgo := time.Now().AddDate(-1, 0, 0)
+	jobs := []*models.Job{
+		createJobWithStatus(t, "pruning-successful_without_retention", models.SUCCESSFUL_JOB, yearAgo),
+		createJobWithStatus(t, "pruning-dead_without_retention", models.DEAD_JOB, yearAgo),
+	}
+	defer deleteJobs(t, jobs)
+
+	pruning, err := models.PruneJobs(time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), pruning.SuccessfulJobCount)
+	assert.Equal(t, int64(0), pruning.DeadJobCount)
+
+	for _, job := range jobs {
+		_, err := models.FindJob(job.ID)
+		assert.Nil(t, err, "Job %v should be kept", job.Name)
+	}
+}
+
+// createJobWithStatus creates the job 'name' with 'status', last updated at 'updatedAt' & with one attempt
+func createJobWithStatus(t *testing.T, name, status string, updatedAt time.Time) *models.Job {
+	err := models.CreateScheduledJob(name, "prune_me", TEST_PRUNING_QUEUE, 0, "{}", time.Now().AddDate(1, 0, 0))
+	assert.Nil(t, err)
+
+	// The job just created is the latest one
+	jobs, _, err := models.FetchJobs(1)
+	assert.Nil(t, err)
+	job := &jobs[0]
+	assert.Equal(t, name, job.Name)
+
+	assert.Nil(t, models.CreateJobAttempt(&models.JobAttempt{JobID: job.ID, Outcome: models.SUCCEEDED_JOB_ATTEMPT}))
+
+	jobStatus, err := models.FindJobStatus(status)
+	assert.Nil(t, err)
+	assert.Nil(t, job.Update(map[string]interface{}{"job_status_id": jobStatus.ID, "updated_at": updatedAt}))
+
+	return job
+}
+
+// deleteJobs deletes the 'jobs' that weren't pruned, so they aren't left in the shared test db
+func deleteJobs(t *testing.T, jobs []*models.Job) {
+	deadStatus, err := models.FindJobStatus(models.DEAD_JOB)
+	assert.Nil(t, err)
+
+	for _, job := range jobs {
+		if _, err := models.FindJob(job.ID); err != nil {
+			continue
+		}
+
+		// A job in progress can't be deleted
+		assert.Nil(t, job.Update(map[string]interface{}{"job_status_id": deadStatus.ID}))
+		assert.Nil(t, models.DeleteJob(job.ID))
+	}
+}
@@ -0,0 +1,94 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+)
+
+var emailHTMLTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+  <body style="font-family: Arial, Helvetica, sans-serif; font-size: 15px; color: #222;">
+    {{range .}}<p>{{.}}</p>
+    {{end}}<p style="color: #888; font-size: 12px;">Sent by kronus</p>
+  </body>
+</html>
+`))
+
+// Mailer is implemented by every channel kronus can send emails through.
+// An email should not be sent once 'ctx' is done.
+type Mailer interface {
+	SendEmail(ctx context.Context, email Email) error
+}
+
+type Email struct {
+	To          string
+	Subject     string
+	TextBody    string
+	HTMLBody    string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Content     []byte
+}
+
+// NewEmail creates an email with both a plain-text & HTML body from the plain-text 'body'
+func NewEmail(to, subject, body string) (Email, error) {
+	htmlBody := new(bytes.Buffer)
+	err := emailHTMLTemplate.Execute(htmlBody, strings.Split(body, "\n"))
+	if err != nil {
+		return Email{}, fmt.Errorf("messenger: unable to render email html: %v", err)
+	}
+
+	return Email{
+		To:       to,
+		Subject:  subject,
+		TextBody: body,
+		HTMLBody: htmlBody.String(),
+	}, nil
+}
+
+// MemoryMailer records every email sent through it in memory.
+// It's meant to be used in tests.
+type MemoryMailer struct {
+	mu     sync.Mutex
+	emails []Email
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (mm *MemoryMailer) SendEmail(ctx context.Context, email Email) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.emails = append(mm.emails, email)
+	return nil
+}
+
+// EmailsTo returns a copy of all emails recorded for the 'to' recipient
+func (mm *MemoryMailer) EmailsTo(to string) []Email {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	emails := []Email{}
+	for _, email := range mm.emails {
+		if email.To == to {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails
+}
@@ -0,0 +1,67 @@
+package messenger
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Daskott/kronus/shared"
+)
+
+const MEMORY_DRIVER = "memory"
+
+type Message struct {
+	To   string
+	Body string
+}
+
+// MemoryMessenger records every message sent through it in memory.
+// It's meant to be used in tests.
+type MemoryMessenger struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func init() {
+	mustRegister(MEMORY_DRIVER, func(config shared.ServerConfig) (Messenger, error) {
+		return NewMemoryMessenger(), nil
+	})
+}
+
+func NewMemoryMessenger() *MemoryMessenger {
+	return &MemoryMessenger{}
+}
+
+func (mm *MemoryMessenger) SendMessage(ctx context.Context, to, msg string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.messages = append(mm.messages, Message{To: to, Body: msg})
+	return nil
+}
+
+// Messages returns a copy of all messages recorded so far
+func (mm *MemoryMessenger) Messages() []Message {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	return append([]Message{}, mm.messages...)
+}
+
+// MessagesTo returns a copy of all messages recorded for the 'to' recipient
+func (mm *MemoryMessenger) MessagesTo(to string) []Message {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	messages := []Message{}
+	for _, msg := range mm.messages {
+		if msg.To == to {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
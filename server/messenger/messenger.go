@@ -0,0 +1,78 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Daskott/kronus/server/logger"
+	"github.com/Daskott/kronus/shared"
+)
+
+var (
+	logg = logger.NewLogger()
+
+	driversMu sync.RWMutex
+	drivers   = make(map[string]DriverFactory)
+)
+
+// Messenger is implemented by every channel kronus can send probe messages through.
+// A message should not be sent once 'ctx' is done.
+type Messenger interface {
+	SendMessage(ctx context.Context, to, msg string) error
+}
+
+// DriverFactory creates a Messenger from the server config
+type DriverFactory func(config shared.ServerConfig) (Messenger, error)
+
+// Register makes a messenger driver available by the provided name.
+// It returns an error if a driver with the same name is already registered.
+func Register(name string, factory DriverFactory) error {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if factory == nil {
+		return fmt.Errorf("messenger: factory for driver %q is nil", name)
+	}
+
+	if _, ok := drivers[name]; ok {
+		return fmt.Errorf("messenger: driver %q already registered", name)
+	}
+
+	drivers[name] = factory
+	return nil
+}
+
+// New creates a Messenger using the driver registered with 'name'
+func New(name string, config shared.ServerConfig) (Messenger, error) {
+	driversMu.RLock()
+	factory, ok := drivers[name]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("messenger: unknown driver %q, must be one of %v", name, Drivers())
+	}
+
+	return factory(config)
+}
+
+// Drivers returns a sorted list of the names of the registered drivers
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := []string{}
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func mustRegister(name string, factory DriverFactory) {
+	if err := Register(name, factory); err != nil {
+		logg.Panic(err)
+	}
+}
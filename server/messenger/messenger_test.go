@@ -0,0 +1,32 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Daskott/kronus/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	msgClient, err := New(MEMORY_DRIVER, shared.ServerConfig{})
+	assert.Nil(t, err)
+
+	err = msgClient.SendMessage(context.Background(), "+12345678900", "Hello")
+	assert.Nil(t, err)
+
+	memoryMessenger, ok := msgClient.(*MemoryMessenger)
+	assert.True(t, ok, "Should create a MemoryMessenger for the 'memory' driver")
+	assert.Equal(t, []Message{{To: "+12345678900", Body: "Hello"}}, memoryMessenger.Messages())
+
+	_, err = New("carrier-pigeon", shared.ServerConfig{})
+	assert.NotNil(t, err, "Should return an error for an unknown driver")
+}
+
+func TestRegister(t *testing.T) {
+	err := Register(STDOUT_DRIVER, func(config shared.ServerConfig) (Messenger, error) {
+		return &StdoutMessenger{}, nil
+	})
+	assert.NotNil(t, err, "Should not register a driver with a duplicate name")
+	assert.Contains(t, Drivers(), TWILIO_DRIVER)
+}
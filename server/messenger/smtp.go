@@ -0,0 +1,223 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/Daskott/kronus/colors"
+	"github.com/Daskott/kronus/shared"
+)
+
+// SmtpMailer sends emails through an SMTP server
+type SmtpMailer struct {
+	config shared.SmtpConfig
+	auth   smtp.Auth
+}
+
+func NewSmtpMailer(config shared.SmtpConfig) *SmtpMailer {
+	var auth smtp.Auth
+
+	// Only authenticate if credentials are provided e.g. local smtp sinks don't need them
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	return &SmtpMailer{config: config, auth: auth}
+}
+
+func (sm *SmtpMailer) SendEmail(ctx context.Context, email Email) error {
+	msg, err := sm.mimeMessage(email)
+	if err != nil {
+		return err
+	}
+
+	err = sm.sendMail(ctx, email.To, msg)
+	if err != nil {
+		return fmt.Errorf("messenger: unable to send email: %w", err)
+	}
+
+	logg.Infof("%v new email sent!", colors.Green("[email]"))
+	return nil
+}
+
+// sendMail sends 'msg' to 'to' like 'smtp.SendMail', except the connection
+// is closed as soon as 'ctx' is done, so the email is abandoned mid-way
+func (sm *SmtpMailer) sendMail(ctx context.Context, to string, msg []byte) error {
+	addr := net.JoinHostPort(sm.config.Host, strconv.Itoa(sm.config.Port))
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	sent := make(chan struct{})
+	defer close(sent)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-sent:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, sm.config.Host)
+	if err != nil {
+		conn.Close()
+		return contextErr(ctx, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: sm.config.Host}); err != nil {
+			return contextErr(ctx, err)
+		}
+	}
+
+	if sm.auth != nil {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(sm.auth); err != nil {
+				return contextErr(ctx, err)
+			}
+		}
+	}
+
+	if err := client.Mail(sm.config.From); err != nil {
+		return contextErr(ctx, err)
+	}
+
+	if err := client.Rcpt(to); err != nil {
+		return contextErr(ctx, err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return contextErr(ctx, err)
+	}
+
+	if _, err := writer.Write(msg); err != nil {
+		return contextErr(ctx, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return contextErr(ctx, err)
+	}
+
+	return contextErr(ctx, client.Quit())
+}
+
+// contextErr returns the error of 'ctx' if it's done i.e. the cause of 'err', otherwise 'err'
+func contextErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// mimeMessage returns 'email' as a multipart/alternative message
+// with both the plain-text & HTML bodies. If the email has attachments,
+// it's wrapped in a multipart/mixed message along with them.
+func (sm *SmtpMailer) mimeMessage(email Email) ([]byte, error) {
+	boundary, err := mimeBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(bytes.Buffer)
+	fmt.Fprintf(msg, "From: %v\r\n", sm.config.From)
+	fmt.Fprintf(msg, "To: %v\r\n", email.To)
+	fmt.Fprintf(msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(msg, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+
+	if len(email.Attachments) == 0 {
+		fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+		if err := writeAlternativeParts(msg, boundary, email); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	alternativeBoundary, err := mimeBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(msg, "--%v\r\n", boundary)
+	fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", alternativeBoundary)
+	if err := writeAlternativeParts(msg, alternativeBoundary, email); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range email.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		fmt.Fprintf(msg, "--%v\r\n", boundary)
+		fmt.Fprintf(msg, "Content-Type: %v\r\n", contentType)
+		fmt.Fprintf(msg, "Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(msg, "Content-Disposition: %v\r\n\r\n",
+			mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+
+		// Keep lines within the 76 character limit
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > 76 {
+			fmt.Fprintf(msg, "%v\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(msg, "%v\r\n", encoded)
+	}
+	fmt.Fprintf(msg, "--%v--\r\n", boundary)
+
+	return msg.Bytes(), nil
+}
+
+// writeAlternativeParts writes the plain-text & HTML bodies of 'email' as multipart/alternative parts
+func writeAlternativeParts(msg *bytes.Buffer, boundary string, email Email) error {
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", email.TextBody},
+		{"text/html", email.HTMLBody},
+	}
+
+	for _, part := range parts {
+		fmt.Fprintf(msg, "--%v\r\n", boundary)
+		fmt.Fprintf(msg, "Content-Type: %v; charset=\"utf-8\"\r\n", part.contentType)
+		fmt.Fprintf(msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		writer := quotedprintable.NewWriter(msg)
+		if _, err := writer.Write([]byte(part.body)); err != nil {
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(msg, "\r\n")
+	}
+	fmt.Fprintf(msg, "--%v--\r\n", boundary)
+
+	return nil
+}
+
+func mimeBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("kronus-%x", b), nil
+}
@@ -0,0 +1,119 @@
+package messenger
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/Daskott/kronus/shared"
+	"github.com/stretchr/testify/assert"
+)
+
+// startSmtpSink starts a bare-bones smtp server that accepts a single email
+// and sends its raw DATA to the returned channel
+func startSmtpSink(t *testing.T) (net.Listener, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost kronus-sink")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 localhost")
+			case "MAIL", "RCPT", "RSET", "NOOP":
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 send data")
+				data, _ := text.ReadDotBytes()
+				received <- string(data)
+				text.PrintfLine("250 OK")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	return listener, received
+}
+
+func TestSmtpMailerSendEmail(t *testing.T) {
+	listener, received := startSmtpSink(t)
+	defer listener.Close()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	mailer := NewSmtpMailer(shared.SmtpConfig{
+		Host: "127.0.0.1",
+		Port: addr.Port,
+		From: "kronus@avengers.com",
+	})
+
+	email, err := NewEmail("stark@avengers.com", "Kronus check in", "Hi Tony,\nAre you good ? (Y/N)")
+	assert.Nil(t, err)
+	assert.Contains(t, email.HTMLBody, "<p>Hi Tony,</p>")
+
+	err = mailer.SendEmail(context.Background(), email)
+	assert.Nil(t, err)
+
+	data := <-received
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	header, err := reader.ReadMIMEHeader()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "stark@avengers.com", header.Get("To"))
+	assert.Equal(t, "Kronus check in", header.Get("Subject"))
+	assert.Contains(t, header.Get("Content-Type"), "multipart/alternative")
+	assert.Contains(t, data, "text/plain")
+	assert.Contains(t, data, "text/html")
+	assert.Contains(t, data, "Are you good ? (Y/N)")
+}
+
+func TestSmtpMailerSendEmailWithAttachments(t *testing.T) {
+	listener, received := startSmtpSink(t)
+	defer listener.Close()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	mailer := NewSmtpMailer(shared.SmtpConfig{
+		Host: "127.0.0.1",
+		Port: addr.Port,
+		From: "kronus@avengers.com",
+	})
+
+	email, err := NewEmail("pepper@avengers.com", "A message from Tony", "Hi Pepper,\nSee attached.")
+	assert.Nil(t, err)
+	email.Attachments = []Attachment{{FileName: "will.txt", ContentType: "text/plain", Content: []byte("Everything goes to Morgan")}}
+
+	err = mailer.SendEmail(context.Background(), email)
+	assert.Nil(t, err)
+
+	data := <-received
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(data)))
+	header, err := reader.ReadMIMEHeader()
+	assert.Nil(t, err)
+
+	assert.Contains(t, header.Get("Content-Type"), "multipart/mixed")
+	assert.Contains(t, data, "multipart/alternative")
+	assert.Contains(t, data, "See attached.")
+	assert.Contains(t, data, `Content-Disposition: attachment; filename=will.txt`)
+	assert.Contains(t, data, base64.StdEncoding.EncodeToString([]byte("Everything goes to Morgan")))
+}
@@ -0,0 +1,25 @@
+package messenger
+
+import (
+	"context"
+
+	"github.com/Daskott/kronus/colors"
+	"github.com/Daskott/kronus/shared"
+)
+
+const STDOUT_DRIVER = "stdout"
+
+// StdoutMessenger logs messages to stdout instead of sending them.
+// It's meant to be used in dev mode.
+type StdoutMessenger struct{}
+
+func init() {
+	mustRegister(STDOUT_DRIVER, func(config shared.ServerConfig) (Messenger, error) {
+		return &StdoutMessenger{}, nil
+	})
+}
+
+func (sm *StdoutMessenger) SendMessage(ctx context.Context, to, msg string) error {
+	logg.Infof("%v to: %v; body: %v", colors.Green("[message]"), to, msg)
+	return nil
+}
@@ -0,0 +1,14 @@
+package messenger
+
+import (
+	"github.com/Daskott/kronus/server/twilio"
+	"github.com/Daskott/kronus/shared"
+)
+
+const TWILIO_DRIVER = "twilio"
+
+func init() {
+	mustRegister(TWILIO_DRIVER, func(config shared.ServerConfig) (Messenger, error) {
+		return twilio.NewClient(config.Twilio, config.Kronus.PublicUrl), nil
+	})
+}
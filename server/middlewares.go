@@ -22,6 +22,13 @@ func (r *ResponseWriterWithStatus) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Flush lets streaming handlers e.g. the event stream, flush responses through the wrapper
+func (r *ResponseWriterWithStatus) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
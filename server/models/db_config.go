@@ -52,6 +52,14 @@ func InitializeTestDb() error {
 		return err
 	}
 
+	// Connections sharing the in-memory cache fail with 'database table is locked' instead of waiting
+	// on each other, so use a single connection to serialize writes from concurrent workers.
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
 	return autoMigrateAndSeedDb()
 }
 
@@ -99,7 +107,9 @@ func autoMigrateAndSeedDb() error {
 	err := db.AutoMigrate(
 		&ProbeStatus{}, &JobStatus{}, &Job{},
 		&Role{}, &Probe{}, &Contact{}, &ProbeSetting{},
-		&User{}, &EmergencyProbe{},
+		&User{}, &EmergencyProbe{}, &EscalationStep{}, &ProbeSchedule{},
+		&ReleasePayload{}, &ReleasePayloadAttachment{}, &PayloadRelease{},
+		&Webhook{}, &WebhookDelivery{}, &PeriodicJob{}, &JobPruning{}, &JobAttempt{},
 	)
 	if err != nil {
 		return err
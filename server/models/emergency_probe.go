@@ -1,19 +1,133 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type EmergencyProbe struct {
 	BaseModel
-	ContactID uint `json:"contact_id,omitempty"`
-	ProbeID   uint `json:"probe_id,omitempty"`
+	ContactID uint     `json:"contact_id,omitempty"`
+	Contact   *Contact `json:"contact,omitempty"`
+	ProbeID   uint     `json:"probe_id,omitempty"`
+
+	// Position of the escalation step the emergency probe was sent for
+	Position int `json:"position"`
+
+	// When the contact acknowledged they're acting on the emergency probe, if they have
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+}
+
+func (emergencyProbe *EmergencyProbe) Update(data map[string]interface{}) error {
+	// Doing this to make sure only keys in data are updated
+	return db.Model(EmergencyProbe{}).Where("id = ?", emergencyProbe.ID).Updates(data).Error
+}
+
+func (emergencyProbe *EmergencyProbe) Delete() error {
+	return db.Delete(&EmergencyProbe{}, emergencyProbe.ID).Error
 }
 
-func CreateEmergencyProbe(probeID, contactID interface{}) error {
+// Acknowledge marks the emergency probe as acknowledged by its contact.
+// It returns false if the emergency probe was already acknowledged.
+func (emergencyProbe *EmergencyProbe) Acknowledge() (bool, error) {
 	currentTime := time.Now()
-	return db.Model(&EmergencyProbe{}).Create(map[string]interface{}{
-		"probe_id":   probeID,
-		"contact_id": contactID,
-		"created_at": currentTime,
-		"updated_at": currentTime,
-	}).Error
+	res := db.Model(&EmergencyProbe{}).
+		Where("id = ? AND acknowledged_at IS NULL", emergencyProbe.ID).
+		Update("acknowledged_at", currentTime)
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	if res.RowsAffected > 0 {
+		emergencyProbe.AcknowledgedAt = &currentTime
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func CreateEmergencyProbe(probeID, contactID interface{}, position int) (*EmergencyProbe, error) {
+	currentTime := time.Now()
+	emergencyProbe := EmergencyProbe{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&EmergencyProbe{}).Create(map[string]interface{}{
+			"probe_id":   probeID,
+			"contact_id": contactID,
+			"position":   position,
+			"created_at": currentTime,
+			"updated_at": currentTime,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("probe_id = ? AND contact_id = ?", probeID, contactID).Last(&emergencyProbe).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &emergencyProbe, nil
+}
+
+func FindEmergencyProbe(id interface{}) (*EmergencyProbe, error) {
+	emergencyProbe := EmergencyProbe{}
+	err := db.Preload("Contact").First(&emergencyProbe, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &emergencyProbe, nil
+}
+
+// FetchEmergencyProbes returns all emergency probes sent out for the probe with 'probeID' in order,
+// including their contacts
+func FetchEmergencyProbes(probeID interface{}) ([]EmergencyProbe, error) {
+	emergencyProbes := []EmergencyProbe{}
+	err := db.Preload("Contact").Scopes(preloadEmergencyProbesInOrder).
+		Where("probe_id = ?", probeID).Find(&emergencyProbes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return emergencyProbes, nil
+}
+
+// ProbeAcknowledgement returns the emergency probe through which the probe with 'probeID'
+// was acknowledged, or 'gorm.ErrRecordNotFound' if no contact has acknowledged it
+func ProbeAcknowledgement(probeID interface{}) (*EmergencyProbe, error) {
+	emergencyProbe := EmergencyProbe{}
+	err := db.Preload("Contact").
+		Where("probe_id = ? AND acknowledged_at IS NOT NULL", probeID).
+		Order("acknowledged_at asc").First(&emergencyProbe).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &emergencyProbe, nil
+}
+
+// LastUnacknowledgedEmergencyProbe returns the last emergency probe sent to a contact
+// with 'phoneNumber' after 'sentAfter', which hasn't been acknowledged
+//
+// WARNING: THIS QUERY IS UNIQE TO SQLITE, REMEMBER TO UPDATE IT IF/WHEN
+// OTHER SQL DATABASES ARE SUPPORTED
+func LastUnacknowledgedEmergencyProbe(phoneNumber string, sentAfter time.Time) (*EmergencyProbe, error) {
+	emergencyProbe := EmergencyProbe{}
+	err := db.Preload("Contact").
+		Joins("INNER JOIN contacts ON contacts.id = emergency_probes.contact_id AND contacts.phone_number = ?", phoneNumber).
+		Where("emergency_probes.acknowledged_at IS NULL").
+		Where("datetime(emergency_probes.created_at) > datetime(?)", sentAfter.UTC()).
+		Order("emergency_probes.id desc").First(&emergencyProbe).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &emergencyProbe, nil
+}
+
+func preloadEmergencyProbesInOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("emergency_probes.position asc")
 }
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const MAX_ESCALATION_STEPS = 5
+
+var (
+	ErrInvalidEscalationContact   = errors.New("escalation step 'contact_id' must be one of the user's contacts")
+	ErrDuplicateEscalationContact = errors.New("a contact can only be in an escalation policy once")
+)
+
+// EscalationStep is a step in a user's escalation policy, i.e. the order in which
+// contacts are reached out to when an emergency probe fires. Each step's contact is
+// reached out to 'DelayInMinutes' after the emergency probe fires.
+type EscalationStep struct {
+	BaseModel
+	UserID         uint     `json:"user_id" gorm:"not null;index"`
+	ContactID      uint     `json:"contact_id" validate:"required" gorm:"not null"`
+	Contact        *Contact `json:"contact,omitempty"`
+	Position       int      `json:"position"`
+	DelayInMinutes int      `json:"delay_in_minutes" validate:"gte=0,lte=1440"`
+}
+
+// EscalationPolicy returns the user's escalation steps in order
+func (user *User) EscalationPolicy() ([]EscalationStep, error) {
+	steps := []EscalationStep{}
+	err := db.Preload("Contact").Where("user_id = ?", user.ID).Order("position asc").Find(&steps).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return steps, nil
+}
+
+// SetEscalationPolicy replaces the user's escalation policy with 'steps'.
+// The steps are ranked in the order provided.
+func (user *User) SetEscalationPolicy(steps []EscalationStep) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		seenContacts := make(map[uint]bool)
+		for i := range steps {
+			if seenContacts[steps[i].ContactID] {
+				return ErrDuplicateEscalationContact
+			}
+			seenContacts[steps[i].ContactID] = true
+
+			err := tx.Where("id = ? AND user_id = ?", steps[i].ContactID, user.ID).First(&Contact{}).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidEscalationContact
+			}
+
+			if err != nil {
+				return err
+			}
+
+			steps[i].ID = 0
+			steps[i].UserID = user.ID
+			steps[i].Position = i
+		}
+
+		err := tx.Where("user_id = ?", user.ID).Delete(&EscalationStep{}).Error
+		if err != nil {
+			return err
+		}
+
+		if len(steps) == 0 {
+			return nil
+		}
+
+		return tx.Create(&steps).Error
+	})
+}
+
+// EscalationChain returns the steps to follow when an emergency probe fires for the user.
+// If the user has no escalation policy, the user's emergency contact (if any) is the only step.
+func (user *User) EscalationChain() ([]EscalationStep, error) {
+	steps, err := user.EscalationPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(steps) > 0 {
+		return steps, nil
+	}
+
+	contact, err := user.EmergencyContact()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return steps, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []EscalationStep{{UserID: user.ID, ContactID: contact.ID, Contact: contact}}, nil
+}
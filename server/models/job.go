@@ -5,16 +5,28 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Daskott/kronus/server/events"
 	"gorm.io/gorm"
 )
 
-var ErrDuplicateJob = errors.New("job with the given name already exists in queue")
+var (
+	ErrDuplicateJob    = errors.New("job with the given name already exists in queue")
+	ErrJobNotDead      = errors.New("only a dead job can be retried")
+	ErrJobNotScheduled = errors.New("only a scheduled job can be cancelled")
+	ErrJobInProgress   = errors.New("an in-progress job can't be deleted")
+)
 
 type Job struct {
 	BaseModel
-	Fails        int        `json:"fails"`
-	Name         string     `json:"name"`
-	Handler      string     `json:"handler"`
+	Fails   int    `json:"fails"`
+	Name    string `json:"name"`
+	Handler string `json:"handler"`
+
+	// The named queue the job is processed from, so each queue's workers only pick up their own jobs
+	Queue string `json:"queue" gorm:"index;not null;default:default"`
+
+	// Jobs with a higher priority are picked up from their queue first
+	Priority     int        `json:"priority" gorm:"index;not null;default:2"`
 	Args         string     `json:"args"`
 	LastError    string     `json:"last_error"`
 	Claimed      bool       `json:"claimed" gorm:"default:false"`
@@ -40,55 +52,100 @@ func (job *Job) MarkAsClaimed() (bool, error) {
 		return false, res.Error
 	}
 
+	if res.RowsAffected > 0 {
+		job.Claimed = true
+		PublishJobEvent(*job, &inProgressStatus)
+	}
+
 	return res.RowsAffected > 0, nil
 }
 
+// PublishJobEvent publishes the event for 'job' moving to the queue with 'jobStatus'
+func PublishJobEvent(job Job, jobStatus *JobStatus) {
+	job.JobStatusID = jobStatus.ID
+	job.JobStatus = jobStatus
+	events.Publish(events.JobEventType(jobStatus.Name), 0, job)
+}
+
 func (job *Job) Update(data map[string]interface{}) error {
 	// Doing this to make sure only keys in data are updated
 	return db.Model(Job{}).Where("id = ?", job.ID).Updates(data).Error
 }
 
-func CreateUniqueJobByName(name string, handler string, args string) error {
-	queuedJobStatuses := []JobStatus{}
-	err := db.Where("name IN ('enqueued', 'in-progress')").Find(&queuedJobStatuses).Error
+// CreateUniqueJobByName enqueues a new job, unless a job with the same 'name' is already enqueued, in-progress,
+// or scheduled to be retried after failing i.e. in backoff. In which case 'ErrDuplicateJob' is returned.
+func CreateUniqueJobByName(name, handler, queue string, priority int, args string) error {
+	duplicate, err := duplicateJobExists(name)
 	if err != nil {
 		return err
 	}
 
-	// Check to see if a job with the same name is either enqueued or in-progress
-	// if one exists, return 'duplicate' error
-	statusIDs := []uint{queuedJobStatuses[0].ID, queuedJobStatuses[1].ID}
-	results := db.Where("name = ? AND job_status_id IN ?", name, statusIDs).First(&Job{})
-
-	if results.Error != nil && !errors.Is(results.Error, gorm.ErrRecordNotFound) {
-		return err
-	}
-
-	if results.RowsAffected > 0 {
+	if duplicate {
 		return ErrDuplicateJob
 	}
 
-	var enqueuedJobStatus JobStatus
-	for _, jobStatus := range queuedJobStatuses {
-		if jobStatus.Name == ENQUEUED_JOB {
-			enqueuedJobStatus = jobStatus
-			break
-		}
+	enqueuedJobStatus, err := FindJobStatus(ENQUEUED_JOB)
+	if err != nil {
+		return err
 	}
 
 	// If a job with the given name already exists & is 'enqueued', do nothing
-	return db.FirstOrCreate(&Job{
+	job := Job{
 		Name:        name,
 		Handler:     handler,
+		Queue:       queue,
+		Priority:    priority,
 		Args:        args,
 		JobStatusID: enqueuedJobStatus.ID,
 		EnqueuedAt:  time.Now(),
-	}, Job{Name: name, JobStatusID: enqueuedJobStatus.ID}).Error
+	}
+	results := db.FirstOrCreate(&job, Job{Name: name, JobStatusID: enqueuedJobStatus.ID})
+	if results.Error != nil {
+		return results.Error
+	}
+
+	// Only a newly created job was enqueued
+	if results.RowsAffected > 0 {
+		PublishJobEvent(job, enqueuedJobStatus)
+	}
+	return nil
+}
+
+// duplicateJobExists returns true if a job with 'name' is already enqueued, in-progress,
+// or scheduled to be retried after failing i.e. in backoff
+func duplicateJobExists(name string) (bool, error) {
+	queuedJobStatuses := []JobStatus{}
+	err := db.Where("name IN ?", []string{ENQUEUED_JOB, IN_PROGRESS_JOB, SCHEDULED_JOB}).Find(&queuedJobStatuses).Error
+	if err != nil {
+		return false, err
+	}
+
+	statusIDs := []uint{}
+	var scheduledJobStatusID uint
+	for _, jobStatus := range queuedJobStatuses {
+		if jobStatus.Name == SCHEDULED_JOB {
+			scheduledJobStatusID = jobStatus.ID
+			continue
+		}
+		statusIDs = append(statusIDs, jobStatus.ID)
+	}
+
+	var duplicates int64
+	err = db.Model(&Job{}).
+		Where("name = ? AND (job_status_id IN ? OR (job_status_id = ? AND fails > 0))", name, statusIDs, scheduledJobStatusID).
+		Count(&duplicates).Error
+	if err != nil {
+		return false, err
+	}
+
+	return duplicates > 0, nil
 }
 
 func CreateScheduledJob(
 	name string,
 	handler string,
+	queue string,
+	priority int,
 	args string, addToQueueAt time.Time) error {
 
 	scheduledStatus := JobStatus{}
@@ -100,16 +157,21 @@ func CreateScheduledJob(
 	return db.Create(&Job{
 		Name:         name,
 		Handler:      handler,
+		Queue:        queue,
+		Priority:     priority,
 		Args:         args,
 		JobStatusID:  scheduledStatus.ID,
 		AddToQueueAt: addToQueueAt,
 	}).Error
 }
 
-func FirstJob(status string, claimed bool) (*Job, error) {
+// FirstJob returns the job in 'queue' with 'status' that has the highest priority.
+// Jobs with the same priority are returned in the order they were enqueued.
+func FirstJob(status string, claimed bool, queue string) (*Job, error) {
 	job := Job{}
 	err := db.Joins("INNER JOIN job_statuses ON job_statuses.id = jobs.job_status_id AND job_statuses.name = ? AND claimed = ? ",
-		status, claimed).First(&job).Error
+		status, claimed).Where("queue = ?", queue).
+		Order("jobs.priority desc").Order("jobs.enqueued_at asc").First(&job).Error
 	if err != nil {
 		return nil, err
 	}
@@ -180,9 +242,67 @@ func CurrentJobsStats() (*JobsStats, error) {
 		return nil, err
 	}
 
+	err = db.Joins(JOIN_QUERY, SCHEDULED_JOB).Model(&Job{}).Count(&stats.ScheduledJobCount).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats.ByPriority, err = currentJobsStatsByPriority()
+	if err != nil {
+		return nil, err
+	}
+
+	prunedStats, err := CurrentJobsPrunedStats()
+	if err != nil {
+		return nil, err
+	}
+	stats.Pruned = *prunedStats
+
 	return &stats, nil
 }
 
+// currentJobsStatsByPriority returns the no. of jobs in each group, for each priority jobs have.
+// Ordered from the highest priority to the lowest.
+func currentJobsStatsByPriority() ([]JobsPriorityStats, error) {
+	counts := []struct {
+		Priority int
+		Status   string
+		Count    int64
+	}{}
+
+	err := db.Model(&Job{}).
+		Select("jobs.priority AS priority, job_statuses.name AS status, COUNT(*) AS count").
+		Joins("INNER JOIN job_statuses ON job_statuses.id = jobs.job_status_id").
+		Group("jobs.priority").Group("job_statuses.name").
+		Order("jobs.priority desc").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byPriority := []JobsPriorityStats{}
+	for _, count := range counts {
+		if len(byPriority) == 0 || byPriority[len(byPriority)-1].Priority != count.Priority {
+			byPriority = append(byPriority, JobsPriorityStats{Priority: count.Priority})
+		}
+
+		stats := &byPriority[len(byPriority)-1]
+		switch count.Status {
+		case ENQUEUED_JOB:
+			stats.EnueuedJobCount = count.Count
+		case IN_PROGRESS_JOB:
+			stats.InProgressJobCount = count.Count
+		case SUCCESSFUL_JOB:
+			stats.SuccessfulJobCount = count.Count
+		case DEAD_JOB:
+			stats.DeadJobCount = count.Count
+		case SCHEDULED_JOB:
+			stats.ScheduledJobCount = count.Count
+		}
+	}
+
+	return byPriority, nil
+}
+
 // LastJobLastUpdated returns the last job which was last updated 'arg1' minutes ago
 // and is of 'arg2' status.
 // i.e last record where job.updated_at + 'arg1' minutes <= 'now'.
@@ -226,3 +346,165 @@ func FirstScheduledJobToBeQueued() (*Job, error) {
 
 	return job, nil
 }
+
+// NextScheduledJobAt returns when the next 'scheduled' job is due to be added to the queue
+//
+// WARNING: THIS QUERY IS UNIQE TO SQLITE, REMEMBER TO UPDATE IT IF/WHEN
+// OTHER SQL DATABASES ARE SUPPORTED
+func NextScheduledJobAt() (time.Time, error) {
+	const JOIN_QUERY = "INNER JOIN job_statuses ON job_statuses.id = jobs.job_status_id AND job_statuses.name = ?"
+	job := Job{}
+
+	err := db.Joins(JOIN_QUERY, SCHEDULED_JOB).Select("jobs.id", "jobs.add_to_queue_at").
+		Order("datetime(jobs.add_to_queue_at) asc").Take(&job).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return job.AddToQueueAt, nil
+}
+
+func FindJob(id interface{}) (*Job, error) {
+	job := Job{}
+	err := db.Preload("JobStatus").First(&job, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// RetryDeadJob moves the dead job with 'id' back to the 'enqueued' queue, with its fails reset,
+// so it's retried as if it was just enqueued. Like any enqueued job, it must be unique by name.
+func RetryDeadJob(id interface{}) (*Job, error) {
+	job, err := FindJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.JobStatus == nil || job.JobStatus.Name != DEAD_JOB {
+		return nil, ErrJobNotDead
+	}
+
+	duplicate, err := duplicateJobExists(job.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if duplicate {
+		return nil, ErrDuplicateJob
+	}
+
+	enqueuedJobStatus, err := FindJobStatus(ENQUEUED_JOB)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only update the job if it's still dead, in case it was retried at the same time
+	res := db.Model(&Job{}).Where("id = ? AND job_status_id = ?", job.ID, job.JobStatusID).Updates(map[string]interface{}{
+		"fails":         0,
+		"claimed":       false,
+		"job_status_id": enqueuedJobStatus.ID,
+		"enqueued_at":   time.Now(),
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, ErrJobNotDead
+	}
+
+	job, err = FindJob(job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	PublishJobEvent(*job, enqueuedJobStatus)
+	return job, nil
+}
+
+// RetryDeadJobsByHandler retries all dead jobs for 'handler', and returns the no. of jobs retried.
+// Dead jobs with the same name as a job already in the queue are skipped.
+func RetryDeadJobsByHandler(handler string) (int64, error) {
+	const JOIN_QUERY = "INNER JOIN job_statuses ON job_statuses.id = jobs.job_status_id AND job_statuses.name = ?"
+	var retried int64
+	jobs := []Job{}
+
+	err := db.Joins(JOIN_QUERY, DEAD_JOB).Where("handler = ?", handler).Order("jobs.id asc").Find(&jobs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, job := range jobs {
+		_, err := RetryDeadJob(job.ID)
+		if errors.Is(err, ErrDuplicateJob) || errors.Is(err, ErrJobNotDead) {
+			continue
+		}
+
+		if err != nil {
+			return retried, err
+		}
+
+		retried++
+	}
+
+	return retried, nil
+}
+
+// CancelScheduledJob removes the scheduled job with 'id', before it's added to the queue
+func CancelScheduledJob(id interface{}) error {
+	scheduledStatus, err := FindJobStatus(SCHEDULED_JOB)
+	if err != nil {
+		return err
+	}
+
+	return deleteJobUnless(id, func(job *Job) error {
+		if job.JobStatusID != scheduledStatus.ID {
+			return ErrJobNotScheduled
+		}
+		return nil
+	})
+}
+
+// DeleteJob deletes the job with 'id', as long as it's not being processed by a worker
+func DeleteJob(id interface{}) error {
+	inProgressStatus, err := FindJobStatus(IN_PROGRESS_JOB)
+	if err != nil {
+		return err
+	}
+
+	return deleteJobUnless(id, func(job *Job) error {
+		if job.JobStatusID == inProgressStatus.ID {
+			return ErrJobInProgress
+		}
+		return nil
+	})
+}
+
+// deleteJobUnless deletes the job with 'id', unless 'check' returns an error for it.
+// The job is only deleted if its status hasn't changed since it was checked.
+func deleteJobUnless(id interface{}, check func(job *Job) error) error {
+	job := Job{}
+	err := db.First(&job, "id = ?", id).Error
+	if err != nil {
+		return err
+	}
+
+	if err := check(&job); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("job_status_id = ?", job.JobStatusID).Delete(&Job{}, job.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("job with id=%v was updated while being deleted, try again", job.ID)
+		}
+
+		return tx.Where("job_id = ?", job.ID).Delete(&JobAttempt{}).Error
+	})
+}
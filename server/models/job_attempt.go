@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SUCCEEDED_JOB_ATTEMPT = "succeeded"
+	FAILED_JOB_ATTEMPT    = "failed"
+
+	// The worker was stopped while the job was running, so it was released back to the queue
+	RELEASED_JOB_ATTEMPT = "released"
+)
+
+// JobAttempt is a record of a worker executing a job
+type JobAttempt struct {
+	BaseModel
+	JobID uint `json:"job_id" gorm:"index;not null"`
+
+	// The no. of the attempt for the job, starting from 1
+	Attempt      int       `json:"attempt"`
+	WorkerID     string    `json:"worker_id"`
+	StartedAt    time.Time `json:"started_at"`
+	EndedAt      time.Time `json:"ended_at"`
+	DurationInMs int64     `json:"duration_in_ms"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+func CreateJobAttempt(attempt *JobAttempt) error {
+	var attempts int64
+
+	err := db.Model(&JobAttempt{}).Where("job_id = ?", attempt.JobID).Count(&attempts).Error
+	if err != nil {
+		return err
+	}
+
+	attempt.Attempt = int(attempts) + 1
+	return db.Create(attempt).Error
+}
+
+// FetchJobAttempts returns the executions of the job with 'jobID', latest first
+func FetchJobAttempts(jobID uint, page int) ([]JobAttempt, *Paging, error) {
+	var total int64
+	attempts := []JobAttempt{}
+
+	err := db.Model(&JobAttempt{}).Where("job_id = ?", jobID).Count(&total).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = db.Scopes(paginate(page, MAX_PAGE_SIZE)).Order("id desc").
+		Find(&attempts, "job_id = ?", jobID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	return attempts, newPaging(int64(page), MAX_PAGE_SIZE, total), nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobPruning is a record of the no. of 'successful' & 'dead' jobs deleted by a run of the job retention policy
+type JobPruning struct {
+	BaseModel
+	SuccessfulJobCount int64 `json:"successful_job_count"`
+	DeadJobCount       int64 `json:"dead_job_count"`
+}
+
+// JobsPrunedStats is the no. of jobs deleted by the job retention policy so far, & when it last ran
+type JobsPrunedStats struct {
+	SuccessfulJobCount int64      `json:"successful_job_count"`
+	DeadJobCount       int64      `json:"dead_job_count"`
+	LastPrunedAt       *time.Time `json:"last_pruned_at"`
+}
+
+// PruneJobs deletes 'successful' jobs last updated before 'successfulBefore', & 'dead' jobs last updated
+// before 'deadBefore'. A zero time keeps all jobs with that status. The no. of jobs deleted is recorded & returned.
+func PruneJobs(successfulBefore, deadBefore time.Time) (*JobPruning, error) {
+	pruning := JobPruning{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pruning.SuccessfulJobCount, err = pruneJobsByStatus(tx, SUCCESSFUL_JOB, successfulBefore)
+		if err != nil {
+			return err
+		}
+
+		pruning.DeadJobCount, err = pruneJobsByStatus(tx, DEAD_JOB, deadBefore)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&pruning).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pruning, nil
+}
+
+// CurrentJobsPrunedStats returns the total no. of jobs deleted by the job retention policy
+func CurrentJobsPrunedStats() (*JobsPrunedStats, error) {
+	stats := JobsPrunedStats{}
+
+	err := db.Model(&JobPruning{}).
+		Select("COALESCE(SUM(successful_job_count), 0) AS successful_job_count, " +
+			"COALESCE(SUM(dead_job_count), 0) AS dead_job_count").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lastPruning := JobPruning{}
+	err = db.Order("id desc").Take(&lastPruning).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if err == nil {
+		stats.LastPrunedAt = &lastPruning.CreatedAt
+	}
+
+	return &stats, nil
+}
+
+// pruneJobsByStatus deletes the jobs with 'status' last updated before 'before' along with their attempts,
+// & returns the no. of jobs deleted
+//
+// WARNING: THIS QUERY IS UNIQE TO SQLITE, REMEMBER TO UPDATE IT IF/WHEN
+// OTHER SQL DATABASES ARE SUPPORTED
+func pruneJobsByStatus(tx *gorm.DB, status string, before time.Time) (int64, error) {
+	if before.IsZero() {
+		return 0, nil
+	}
+
+	jobStatus := JobStatus{}
+	err := tx.Where(&JobStatus{Name: status}).First(&jobStatus).Error
+	if err != nil {
+		return 0, err
+	}
+
+	prunedJobs := tx.Model(&Job{}).Select("id").
+		Where("job_status_id = ? AND datetime(updated_at) < datetime(?)", jobStatus.ID, before.UTC())
+
+	err = tx.Where("job_id IN (?)", prunedJobs).Delete(&JobAttempt{}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	res := tx.Where("job_status_id = ? AND datetime(updated_at) < datetime(?)", jobStatus.ID, before.UTC()).
+		Delete(&Job{})
+	return res.RowsAffected, res.Error
+}
@@ -8,6 +8,12 @@ const (
 	SCHEDULED_JOB   = "scheduled"
 )
 
+// The queue jobs are added to, if no queue is given
+const DEFAULT_JOB_QUEUE = "default"
+
+// The priority jobs are given, if no priority is given
+const DEFAULT_JOB_PRIORITY = 2
+
 var JobStatusNameMap = map[string]bool{
 	ENQUEUED_JOB:    true,
 	IN_PROGRESS_JOB: true,
@@ -21,6 +27,22 @@ type JobsStats struct {
 	InProgressJobCount int64 `json:"in_progress_job_count"`
 	SuccessfulJobCount int64 `json:"successful_job_count"`
 	DeadJobCount       int64 `json:"dead_job_count"`
+	ScheduledJobCount  int64 `json:"scheduled_job_count"`
+
+	// The no. of jobs in each group, for each priority
+	ByPriority []JobsPriorityStats `json:"by_priority"`
+
+	// The no. of jobs deleted by the job retention policy
+	Pruned JobsPrunedStats `json:"pruned"`
+}
+
+type JobsPriorityStats struct {
+	Priority           int   `json:"priority"`
+	EnueuedJobCount    int64 `json:"enueued_job_count"`
+	InProgressJobCount int64 `json:"in_progress_job_count"`
+	SuccessfulJobCount int64 `json:"successful_job_count"`
+	DeadJobCount       int64 `json:"dead_job_count"`
+	ScheduledJobCount  int64 `json:"scheduled_job_count"`
 }
 
 type JobStatus struct {
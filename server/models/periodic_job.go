@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PeriodicJob is the definition of a job added to the queue periodically, based on its cron expression
+// e.g. a user's liveliness probe. It's unique by name.
+type PeriodicJob struct {
+	BaseModel
+	Name           string `json:"name" gorm:"uniqueIndex;not null"`
+	Handler        string `json:"handler" gorm:"not null"`
+	Queue          string `json:"queue" gorm:"not null;default:default"`
+	Priority       int    `json:"priority"`
+	Args           string `json:"args"`
+	CronExpression string `json:"cron_expression" gorm:"not null"`
+	TimeZone       string `json:"time_zone" gorm:"not null"`
+
+	// A paused job isn't added to the queue, until it's resumed
+	Paused    bool       `json:"paused" gorm:"default:false"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	NextRunAt *time.Time `json:"next_run_at"`
+}
+
+func (periodicJob *PeriodicJob) Update(data map[string]interface{}) error {
+	return db.Model(periodicJob).Updates(data).Error
+}
+
+// SavePeriodicJob creates 'periodicJob', or updates the definition of the periodic job with the same name.
+// If it already exists, whether it's paused & when it last ran are kept.
+func SavePeriodicJob(periodicJob *PeriodicJob) error {
+	existing, err := FindPeriodicJobByName(periodicJob.Name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.Create(periodicJob).Error
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = existing.Update(map[string]interface{}{
+		"handler":         periodicJob.Handler,
+		"queue":           periodicJob.Queue,
+		"priority":        periodicJob.Priority,
+		"args":            periodicJob.Args,
+		"cron_expression": periodicJob.CronExpression,
+		"time_zone":       periodicJob.TimeZone,
+		"next_run_at":     periodicJob.NextRunAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	existing, err = FindPeriodicJob(existing.ID)
+	if err != nil {
+		return err
+	}
+
+	*periodicJob = *existing
+	return nil
+}
+
+func FindPeriodicJob(id interface{}) (*PeriodicJob, error) {
+	periodicJob := PeriodicJob{}
+	err := db.First(&periodicJob, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &periodicJob, nil
+}
+
+func FindPeriodicJobByName(name string) (*PeriodicJob, error) {
+	periodicJob := PeriodicJob{}
+	err := db.First(&periodicJob, "name = ?", name).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &periodicJob, nil
+}
+
+func FetchPeriodicJobs(page int) ([]PeriodicJob, *Paging, error) {
+	var total int64
+	periodicJobs := []PeriodicJob{}
+
+	err := db.Model(&PeriodicJob{}).Count(&total).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	err = db.Scopes(paginate(page, MAX_PAGE_SIZE)).Order("id asc").Find(&periodicJobs).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	return periodicJobs, newPaging(int64(page), MAX_PAGE_SIZE, total), nil
+}
+
+// AllPeriodicJobs returns the definitions of all periodic jobs
+func AllPeriodicJobs() ([]PeriodicJob, error) {
+	periodicJobs := []PeriodicJob{}
+	err := db.Order("id asc").Find(&periodicJobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return periodicJobs, nil
+}
+
+func DeletePeriodicJobByName(name string) error {
+	return db.Where("name = ?", name).Delete(&PeriodicJob{}).Error
+}
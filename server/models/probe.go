@@ -6,28 +6,59 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Daskott/kronus/server/events"
 	"gorm.io/gorm"
 )
 
+var ErrProbeNotPending = errors.New("probe is no longer pending")
+
 type Probe struct {
 	BaseModel
-	LastResponse   string          `json:"last_response"`
-	RetryCount     int             `json:"retry_count"`
-	EmergencyProbe *EmergencyProbe `json:"emergency_probe,omitempty"`
-	UserID         uint            `json:"user_id" gorm:"not null"`
-	ProbeStatusID  uint            `json:"probe_status_id"`
-	ProbeStatus    *ProbeStatus    `json:"status"`
+	LastResponse string `json:"last_response"`
+	RetryCount   int    `json:"retry_count"`
+
+	// The latest emergency probe sent out for the probe i.e. the last of 'EmergencyProbes'
+	EmergencyProbe *EmergencyProbe `json:"emergency_probe,omitempty" gorm:"-"`
+
+	// The emergency probes sent out for each escalation step, in order
+	EmergencyProbes []EmergencyProbe `json:"emergency_probes,omitempty"`
+	UserID          uint             `json:"user_id" gorm:"not null"`
+	ProbeStatusID   uint             `json:"probe_status_id"`
+	ProbeStatus     *ProbeStatus     `json:"status"`
+
+	// The probe schedule the probe was sent for, if any
+	ProbeScheduleID *uint `json:"probe_schedule_id,omitempty"`
+
+	// Set when the user responded with their duress pin. It's kept out of api responses,
+	// so the probe looks like any other 'good' probe
+	Duress bool `json:"-" gorm:"default:false"`
 
 	// TODO: Remove defaults later & set fields to "not null"
 	MaxRetries        int `json:"max_retries" gorm:"default:3"`
 	WaitTimeInMinutes int `json:"wait_time_in_minutes" gorm:"default:60"`
 }
 
+// probeStatusEvents maps probe statuses to the event published when a probe is set to them
+var probeStatusEvents = map[string]string{
+	GOOD_PROBE:        events.PROBE_GOOD,
+	BAD_PROBE:         events.PROBE_BAD,
+	UNAVAILABLE_PROBE: events.PROBE_UNAVAILABLE,
+	CANCELLED_PROBE:   events.PROBE_CANCELLED,
+}
+
 var ProbeStatusMapToResponse = map[string]map[string]bool{
 	GOOD_PROBE: {"yes": true, "yeah": true, "yh": true, "y": true},
 	BAD_PROBE:  {"no": true, "nope": true, "nah": true, "na": true, "n": true},
 }
 
+// AfterFind sets the probe's 'EmergencyProbe' to its latest emergency probe, if they were loaded
+func (probe *Probe) AfterFind(tx *gorm.DB) error {
+	if len(probe.EmergencyProbes) > 0 {
+		probe.EmergencyProbe = &probe.EmergencyProbes[len(probe.EmergencyProbes)-1]
+	}
+	return nil
+}
+
 func (probe *Probe) Update(data map[string]interface{}) error {
 	return db.Model(probe).Updates(data).Error
 }
@@ -36,6 +67,44 @@ func (probe *Probe) Save() error {
 	return db.Save(&probe).Error
 }
 
+func (probe *Probe) Delete() error {
+	return db.Delete(&Probe{}, probe.ID).Error
+}
+
+// Resolve sets the probe's status to 'status' & saves its 'LastResponse' & 'Duress', only if the probe is
+// still pending. Otherwise 'ErrProbeNotPending' is returned i.e. a probe can only be resolved once,
+// even when it's resolved concurrently e.g. by an sms reply & a check-in link.
+func (probe *Probe) Resolve(status string) error {
+	probeStatus, err := FindProbeStatus(status)
+	if err != nil {
+		return err
+	}
+
+	pendingStatus, err := FindProbeStatus(PENDING_PROBE)
+	if err != nil {
+		return err
+	}
+
+	res := db.Model(&Probe{}).Where("id = ? AND probe_status_id = ?", probe.ID, pendingStatus.ID).
+		Updates(map[string]interface{}{
+			"probe_status_id": probeStatus.ID,
+			"last_response":   probe.LastResponse,
+			"duress":          probe.Duress,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return ErrProbeNotPending
+	}
+
+	probe.ProbeStatusID = probeStatus.ID
+
+	publishProbeStatusEvent(probe.ID, status)
+	return nil
+}
+
 func (probe *Probe) IsPending() (bool, error) {
 	probeStatus := ProbeStatus{}
 
@@ -74,14 +143,35 @@ func SetProbeStatus(probeID interface{}, status string) error {
 		return err
 	}
 
-	err = db.Model(&Probe{}).Where("id = ?", probeID).Update("probe_status_id", probeStatus.ID).Error
-	if err != nil {
-		return err
+	// Only update probes not already set to 'status', so the event isn't published twice
+	res := db.Model(&Probe{}).Where("id = ? AND probe_status_id <> ?", probeID, probeStatus.ID).
+		Update("probe_status_id", probeStatus.ID)
+	if res.Error != nil {
+		return res.Error
 	}
 
+	if res.RowsAffected > 0 {
+		publishProbeStatusEvent(probeID, status)
+	}
 	return nil
 }
 
+// publishProbeStatusEvent publishes the event for the probe with 'probeID' being set to 'status', if any
+func publishProbeStatusEvent(probeID interface{}, status string) {
+	eventType, ok := probeStatusEvents[status]
+	if !ok {
+		return
+	}
+
+	probe := Probe{}
+	err := db.Preload("ProbeStatus").First(&probe, "id = ?", probeID).Error
+	if err != nil {
+		return
+	}
+
+	events.Publish(eventType, probe.UserID, probe)
+}
+
 func FetchProbesByStatus(status, order string, page int) ([]Probe, *Paging, error) {
 	const JOIN_QUERY = "INNER JOIN probe_statuses ON probe_statuses.id = probes.probe_status_id AND probe_statuses.name = ?"
 
@@ -95,7 +185,7 @@ func FetchProbesByStatus(status, order string, page int) ([]Probe, *Paging, erro
 
 	err = db.Scopes(paginate(page, MAX_PAGE_SIZE)).
 		Preload("ProbeStatus").
-		Preload("EmergencyProbe").
+		Preload("EmergencyProbes", preloadEmergencyProbesInOrder).
 		Order(fmt.Sprintf("probes.id %v", order)).Joins(JOIN_QUERY, status).Find(&probes).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil, err
@@ -106,7 +196,7 @@ func FetchProbesByStatus(status, order string, page int) ([]Probe, *Paging, erro
 
 // FetchPendingProbesWithElapsedWait returns all pending probes
 // whose waiting times have expired, with no response from the
-// associated user
+// associated user. Probes of users who are currently snoozed are left out.
 //
 // WARNING: THIS QUERY IS UNIQE TO SQLITE, REMEMBER TO UPDATE IT IF/WHEN
 // OTHER SQL DATABASES ARE SUPPORTED
@@ -116,7 +206,10 @@ func FetchPendingProbesWithElapsedWait() ([]Probe, error) {
 	probes := []Probe{}
 
 	err := db.Joins(JOIN_QUERY, PENDING_PROBE).
-		Where("datetime(probes.updated_at, printf('+%s minute', probes.wait_time_in_minutes)) <= datetime('now')").Find(&probes).Error
+		Joins("INNER JOIN probe_settings ON probe_settings.user_id = probes.user_id").
+		Where("datetime(probes.updated_at, printf('+%s minute', probes.wait_time_in_minutes)) <= datetime('now')").
+		Where("probe_settings.snooze_ends_at IS NULL OR datetime(probe_settings.snooze_ends_at) <= datetime('now') OR "+
+			"datetime(probe_settings.snooze_starts_at) > datetime('now')").Find(&probes).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
 	}
@@ -130,7 +223,7 @@ func FetchProbes(page int, query interface{}, args ...interface{}) ([]Probe, *Pa
 
 	countQuery := db.Model(&Probe{})
 	probeQuery := db.Scopes(paginate(page, MAX_PAGE_SIZE)).
-		Preload("ProbeStatus").Preload("EmergencyProbe").Order("probes.id desc")
+		Preload("ProbeStatus").Preload("EmergencyProbes", preloadEmergencyProbesInOrder).Order("probes.id desc")
 
 	if query != nil && args != nil {
 		countQuery = countQuery.Where(query, args)
@@ -160,22 +253,46 @@ func FindProbe(id interface{}) (*Probe, error) {
 	return &probe, nil
 }
 
-func CreateProbe(userID interface{}, waitTimeInMinutes, maxRetries int) error {
+func CreateProbe(userID uint, waitTimeInMinutes, maxRetries int) (*Probe, error) {
+	return createProbe(userID, waitTimeInMinutes, maxRetries, nil)
+}
+
+// CreateScheduledProbe creates a probe for the probe 'schedule', using its wait time & max retries
+func CreateScheduledProbe(schedule *ProbeSchedule) (*Probe, error) {
+	return createProbe(schedule.UserID, schedule.WaitTimeInMinutes, schedule.MaxRetries, schedule.ID)
+}
+
+func createProbe(userID uint, waitTimeInMinutes, maxRetries int, probeScheduleID interface{}) (*Probe, error) {
 	currentTime := time.Now()
 	pendingProbeStatus := ProbeStatus{}
 	err := db.Where(&ProbeStatus{Name: "pending"}).Find(&pendingProbeStatus).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return db.Model(&Probe{}).Create(map[string]interface{}{
-		"user_id":              userID,
-		"probe_status_id":      pendingProbeStatus.ID,
-		"wait_time_in_minutes": waitTimeInMinutes,
-		"max_retries":          maxRetries,
-		"created_at":           currentTime,
-		"updated_at":           currentTime,
-	}).Error
+	probe := Probe{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Create with a map, so zero values e.g. 'max_retries = 0' aren't replaced by column defaults
+		err := tx.Model(&Probe{}).Create(map[string]interface{}{
+			"user_id":              userID,
+			"probe_status_id":      pendingProbeStatus.ID,
+			"probe_schedule_id":    probeScheduleID,
+			"wait_time_in_minutes": waitTimeInMinutes,
+			"max_retries":          maxRetries,
+			"created_at":           currentTime,
+			"updated_at":           currentTime,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Last(&probe).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &probe, nil
 }
 
 func CurrentProbeStats() (*ProbeStats, error) {
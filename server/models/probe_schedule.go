@@ -0,0 +1,149 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// The most probe schedules a user can have, in addition to their probe settings' schedule
+const MAX_PROBE_SCHEDULES = 10
+
+var (
+	ErrDuplicateProbeScheduleName = errors.New("probe schedule with the same 'name' already exist")
+	ErrMaxProbeSchedules          = errors.New("user already has the max no. of probe schedules")
+)
+
+// ProbeSchedule is a named liveliness probe schedule e.g. "weekday mornings",
+// which a user can have several of
+type ProbeSchedule struct {
+	BaseModel
+	UserID            uint   `json:"user_id" gorm:"index:idx_user_id_name,priority:1,unique;not null"`
+	Name              string `json:"name" validate:"required,max=50" gorm:"index:idx_user_id_name,priority:2;not null"`
+	Active            bool   `json:"active"`
+	CronExpression    string `json:"cron_expression" validate:"required" gorm:"not null"`
+	MaxRetries        int    `json:"max_retries" validate:"gte=0,lte=6"`
+	WaitTimeInMinutes int    `json:"wait_time_in_minutes" validate:"gte=5,lte=120"`
+
+	// If set, probes are sent at a random time within this many minutes after the cron expression fires
+	JitterWindowInMinutes int `json:"jitter_window_in_minutes" validate:"gte=0,lte=720"`
+}
+
+func (user *User) AddProbeSchedule(schedule *ProbeSchedule) error {
+	var total int64
+
+	err := db.Model(&ProbeSchedule{}).Where("user_id = ?", user.ID).Count(&total).Error
+	if err != nil {
+		return err
+	}
+
+	if total >= MAX_PROBE_SCHEDULES {
+		return ErrMaxProbeSchedules
+	}
+
+	schedule.UserID = user.ID
+	err = db.Create(schedule).Error
+
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint") &&
+		strings.Contains(err.Error(), "probe_schedules.name") {
+		return ErrDuplicateProbeScheduleName
+	}
+
+	return err
+}
+
+func (user *User) FetchProbeSchedules() ([]ProbeSchedule, error) {
+	schedules := []ProbeSchedule{}
+
+	err := db.Order("id asc").Find(&schedules, "user_id = ?", user.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (user *User) FindProbeSchedule(id interface{}) (*ProbeSchedule, error) {
+	schedule := ProbeSchedule{}
+
+	err := db.First(&schedule, "id = ? AND user_id = ?", id, user.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+func (user *User) UpdateProbeSchedule(id interface{}, data map[string]interface{}) (*ProbeSchedule, error) {
+	err := db.Model(&ProbeSchedule{}).Where("id = ? AND user_id = ?", id, user.ID).Updates(data).Error
+
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint") &&
+		strings.Contains(err.Error(), "probe_schedules.name") {
+		return nil, ErrDuplicateProbeScheduleName
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user.FindProbeSchedule(id)
+}
+
+func (user *User) DeleteProbeSchedule(id interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Keep probes sent for the schedule
+		err := tx.Model(&Probe{}).Where("user_id = ? AND probe_schedule_id = ?", user.ID, id).
+			Update("probe_schedule_id", nil).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&ProbeSchedule{}, id).Error
+	})
+}
+
+// DisableProbeSchedules turns off all the user's probe schedules
+func (user *User) DisableProbeSchedules() error {
+	return db.Model(&ProbeSchedule{}).Where("user_id = ?", user.ID).Update("active", false).Error
+}
+
+// FindProbeSchedule returns the probe schedule with 'id', whichever user it belongs to
+func FindProbeSchedule(id interface{}) (*ProbeSchedule, error) {
+	schedule := ProbeSchedule{}
+
+	err := db.First(&schedule, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// ActiveProbeSchedules returns all active probe schedules, along with the users they belong to
+func ActiveProbeSchedules() ([]ProbeSchedule, map[uint]User, error) {
+	schedules := []ProbeSchedule{}
+
+	err := db.Where("active = true").Find(&schedules).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	userIDs := []uint{}
+	for _, schedule := range schedules {
+		userIDs = append(userIDs, schedule.UserID)
+	}
+
+	users := []User{}
+	err = db.Preload("ProbeSettings").Select(allFieldsExceptPassword).Find(&users, "id IN ?", userIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usersByID := make(map[uint]User)
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	return schedules, usersByID, nil
+}
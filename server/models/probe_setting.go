@@ -1,8 +1,25 @@
 package models
 
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Daskott/kronus/server/auth"
+)
+
 // At 18:00 every Wednesday
 const DEFAULT_PROBE_CRON_EXPRESSION = "0 18 * * 3"
 
+// Layout of the start & end times of quiet hours e.g. 22:00
+const QUIET_HOURS_LAYOUT = "15:04"
+
+// Pins a user can respond to a probe with
+const (
+	SAFE_PIN   = "safe"
+	DURESS_PIN = "duress"
+)
+
 type ProbeSetting struct {
 	BaseModel
 	UserID            uint   `json:"user_id" gorm:"not null;unique"`
@@ -10,4 +27,117 @@ type ProbeSetting struct {
 	CronExpression    string `json:"cron_expression" gorm:"not null"`
 	MaxRetries        int    `json:"max_retries" gorm:"default:3"`
 	WaitTimeInMinutes int    `json:"wait_time_in_minutes" gorm:"default:60"`
+
+	// If set, probes are sent at a random time within this many minutes after the cron expression fires
+	// e.g. '0 17 * * *' with a 120 min jitter window, sends a probe anytime between 17:00 - 19:00
+	JitterWindowInMinutes int `json:"jitter_window_in_minutes"`
+
+	// Time zone probes are scheduled in e.g. 'America/Toronto'. If empty, the server's time zone is used
+	TimeZone string `json:"time_zone"`
+
+	// Hashes of the user's pins, for responding to probes
+	SafePin   string `json:"-"`
+	DuressPin string `json:"-"`
+
+	// Liveliness probes & followups are paused between these times e.g. for a vacation
+	SnoozeStartsAt *time.Time `json:"snooze_starts_at"`
+	SnoozeEndsAt   *time.Time `json:"snooze_ends_at"`
+
+	// Followups are deferred daily between these times e.g. 22:00 - 07:00, in the user's time zone
+	QuietHoursStart string `json:"quiet_hours_start"`
+	QuietHoursEnd   string `json:"quiet_hours_end"`
+
+	// If true, emergency probes are sent out during quiet hours, instead of being deferred
+	EmergencyBypassesQuietHours bool `json:"emergency_bypasses_quiet_hours" gorm:"default:true"`
+}
+
+// QuietHoursAt returns the quiet hours window 't' falls in, using the quiet hours in 'loc'.
+// 'ok' is false if the user has no quiet hours, or 't' isn't within them.
+func (probeSetting *ProbeSetting) QuietHoursAt(t time.Time, loc *time.Location) (start, end time.Time, ok bool) {
+	if probeSetting.QuietHoursStart == "" || probeSetting.QuietHoursEnd == "" {
+		return start, end, false
+	}
+
+	startClock, err := time.Parse(QUIET_HOURS_LAYOUT, probeSetting.QuietHoursStart)
+	if err != nil {
+		return start, end, false
+	}
+
+	endClock, err := time.Parse(QUIET_HOURS_LAYOUT, probeSetting.QuietHoursEnd)
+	if err != nil {
+		return start, end, false
+	}
+
+	t = t.In(loc)
+	start = time.Date(t.Year(), t.Month(), t.Day(), startClock.Hour(), startClock.Minute(), 0, 0, loc)
+	end = time.Date(t.Year(), t.Month(), t.Day(), endClock.Hour(), endClock.Minute(), 0, 0, loc)
+
+	switch {
+	case start.Equal(end):
+		return start, end, false
+	case start.Before(end):
+		// Quiet hours within the same day e.g. 13:00 - 15:00
+		return start, end, !t.Before(start) && t.Before(end)
+	case !t.Before(start):
+		// Overnight quiet hours e.g. 22:00 - 07:00, which started today
+		return start, end.AddDate(0, 0, 1), true
+	case t.Before(end):
+		// Overnight quiet hours, which started yesterday
+		return start.AddDate(0, 0, -1), end, true
+	}
+
+	return start, end, false
+}
+
+// Location returns the time zone the user's probes are scheduled in,
+// or 'defaultLocation' if the user hasn't set one
+func (probeSetting *ProbeSetting) Location(defaultLocation *time.Location) *time.Location {
+	if probeSetting.TimeZone == "" {
+		return defaultLocation
+	}
+
+	location, err := time.LoadLocation(probeSetting.TimeZone)
+	if err != nil {
+		return defaultLocation
+	}
+
+	return location
+}
+
+// IsSnoozed returns true if liveliness probes are paused at time 't'
+func (probeSetting *ProbeSetting) IsSnoozed(t time.Time) bool {
+	if probeSetting.SnoozeEndsAt == nil || !t.Before(*probeSetting.SnoozeEndsAt) {
+		return false
+	}
+
+	return probeSetting.SnoozeStartsAt == nil || !t.Before(*probeSetting.SnoozeStartsAt)
+}
+
+// HasPin returns true if the user has set the pin of type 'pinType' i.e. SAFE_PIN or DURESS_PIN
+func (probeSetting *ProbeSetting) HasPin(pinType string) bool {
+	if pinType == DURESS_PIN {
+		return probeSetting.DuressPin != ""
+	}
+
+	return probeSetting.SafePin != ""
+}
+
+// MatchPin returns the type of pin i.e. SAFE_PIN or DURESS_PIN 'response' matches, or '' if none
+func (probeSetting *ProbeSetting) MatchPin(response string) string {
+	response = strings.TrimSpace(response)
+
+	// Pins are numeric, so skip comparing hashes for any other response
+	if response == "" || strings.IndexFunc(response, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+		return ""
+	}
+
+	if probeSetting.DuressPin != "" && auth.CheckPasswordHash(response, probeSetting.DuressPin) {
+		return DURESS_PIN
+	}
+
+	if probeSetting.SafePin != "" && auth.CheckPasswordHash(response, probeSetting.SafePin) {
+		return SAFE_PIN
+	}
+
+	return ""
 }
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The most release payloads a user can have
+const MAX_RELEASE_PAYLOADS = 10
+
+var (
+	ErrDuplicateReleasePayloadName  = errors.New("release payload with the same 'name' already exist")
+	ErrMaxReleasePayloads           = errors.New("user already has the max no. of release payloads")
+	ErrUnknownReleasePayloadContact = errors.New("release payload 'contact_id' isn't one of the user's contacts")
+)
+
+// ReleasePayload is a message (& optional attachments) a user wants released to one of
+// their contacts, if they fail to check in & an emergency probe is sent out i.e. a dead man's switch.
+// The message & attachments are encrypted at rest, so they're never included in api responses.
+type ReleasePayload struct {
+	BaseModel
+	UserID    uint     `json:"user_id" gorm:"index:idx_release_payloads_user_id_name,priority:1,unique;not null"`
+	Name      string   `json:"name" gorm:"index:idx_release_payloads_user_id_name,priority:2;not null"`
+	ContactID uint     `json:"contact_id" gorm:"not null"`
+	Contact   *Contact `json:"contact,omitempty"`
+	Message   []byte   `json:"-" gorm:"not null"`
+
+	// How long after the emergency probe is sent, before the payload is released
+	DelayInMinutes int `json:"delay_in_minutes"`
+
+	Attachments     []ReleasePayloadAttachment `json:"attachments" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	PayloadReleases []PayloadRelease           `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type ReleasePayloadAttachment struct {
+	BaseModel
+	ReleasePayloadID uint   `json:"release_payload_id" gorm:"not null"`
+	FileName         string `json:"file_name" gorm:"not null"`
+	ContentType      string `json:"content_type"`
+	Size             int    `json:"size"`
+	Content          []byte `json:"-" gorm:"not null"`
+}
+
+// PayloadRelease is a scheduled release of a release payload, for the probe the user failed to check in for
+type PayloadRelease struct {
+	BaseModel
+	ReleasePayloadID uint            `json:"release_payload_id" gorm:"index:idx_release_payload_id_probe_id,priority:1,unique;not null"`
+	ReleasePayload   *ReleasePayload `json:"release_payload,omitempty"`
+	ProbeID          uint            `json:"probe_id" gorm:"index:idx_release_payload_id_probe_id,priority:2;not null"`
+	UserID           uint            `json:"user_id" gorm:"not null"`
+	ReleaseAt        time.Time       `json:"release_at"`
+	ReleasedAt       *time.Time      `json:"released_at"`
+	CancelledAt      *time.Time      `json:"cancelled_at"`
+}
+
+// IsPending returns true if the payload release hasn't been released or cancelled
+func (payloadRelease *PayloadRelease) IsPending() bool {
+	return payloadRelease.ReleasedAt == nil && payloadRelease.CancelledAt == nil
+}
+
+// MarkAsReleased records the payload release as released.
+// It returns false if the payload release is no longer pending e.g. it was cancelled.
+func (payloadRelease *PayloadRelease) MarkAsReleased() (bool, error) {
+	currentTime := time.Now()
+	res := db.Model(&PayloadRelease{}).
+		Where("id = ? AND released_at IS NULL AND cancelled_at IS NULL", payloadRelease.ID).
+		Update("released_at", currentTime)
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	if res.RowsAffected > 0 {
+		payloadRelease.ReleasedAt = &currentTime
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// AddReleasePayload creates the release 'payload' for the user. The payload's message
+// & attachments' content should already be encrypted.
+func (user *User) AddReleasePayload(payload *ReleasePayload) error {
+	var total int64
+
+	err := db.Model(&ReleasePayload{}).Where("user_id = ?", user.ID).Count(&total).Error
+	if err != nil {
+		return err
+	}
+
+	if total >= MAX_RELEASE_PAYLOADS {
+		return ErrMaxReleasePayloads
+	}
+
+	err = db.Model(&Contact{}).Where("id = ? AND user_id = ?", payload.ContactID, user.ID).Count(&total).Error
+	if err != nil {
+		return err
+	}
+
+	if total == 0 {
+		return ErrUnknownReleasePayloadContact
+	}
+
+	payload.UserID = user.ID
+	err = db.Create(payload).Error
+
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint") &&
+		strings.Contains(err.Error(), "release_payloads.name") {
+		return ErrDuplicateReleasePayloadName
+	}
+
+	return err
+}
+
+func (user *User) FetchReleasePayloads() ([]ReleasePayload, error) {
+	payloads := []ReleasePayload{}
+
+	err := db.Preload("Attachments").Preload("Contact").
+		Order("id asc").Find(&payloads, "user_id = ?", user.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payloads, nil
+}
+
+func (user *User) FindReleasePayload(id interface{}) (*ReleasePayload, error) {
+	payload := ReleasePayload{}
+
+	err := db.Preload("Attachments").Preload("Contact").
+		First(&payload, "id = ? AND user_id = ?", id, user.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &payload, nil
+}
+
+func (user *User) DeleteReleasePayload(id interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return deleteReleasePayloads(tx, "id = ? AND user_id = ?", id, user.ID)
+	})
+}
+
+// deleteReleasePayloads deletes the release payloads matching 'query',
+// along with their attachments & payload releases
+func deleteReleasePayloads(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	payloadIDs := []uint{}
+	err := tx.Model(&ReleasePayload{}).Where(query, args...).Pluck("id", &payloadIDs).Error
+	if err != nil {
+		return err
+	}
+
+	if len(payloadIDs) == 0 {
+		return nil
+	}
+
+	err = tx.Where("release_payload_id IN ?", payloadIDs).Delete(&ReleasePayloadAttachment{}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Where("release_payload_id IN ?", payloadIDs).Delete(&PayloadRelease{}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Delete(&ReleasePayload{}, payloadIDs).Error
+}
+
+// FetchPendingPayloadReleases returns the user's payload releases, which haven't been released or cancelled
+func (user *User) FetchPendingPayloadReleases() ([]PayloadRelease, error) {
+	payloadReleases := []PayloadRelease{}
+
+	err := db.Preload("ReleasePayload").Order("release_at asc").
+		Find(&payloadReleases, "user_id = ? AND released_at IS NULL AND cancelled_at IS NULL", user.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payloadReleases, nil
+}
+
+// CancelPendingPayloadReleases cancels all the user's payload releases, which haven't been released yet.
+// It returns the no. of payload releases cancelled.
+func (user *User) CancelPendingPayloadReleases() (int64, error) {
+	res := db.Model(&PayloadRelease{}).
+		Where("user_id = ? AND released_at IS NULL AND cancelled_at IS NULL", user.ID).
+		Update("cancelled_at", time.Now())
+
+	return res.RowsAffected, res.Error
+}
+
+// CreatePayloadRelease schedules the release 'payload' for the probe with 'probeID' at 'releaseAt'.
+// If the payload was already scheduled for the probe, the existing payload release is returned
+// & 'created' is false.
+func CreatePayloadRelease(payload *ReleasePayload, probeID uint, releaseAt time.Time) (*PayloadRelease, bool, error) {
+	payloadRelease := PayloadRelease{}
+
+	err := db.First(&payloadRelease, "release_payload_id = ? AND probe_id = ?", payload.ID, probeID).Error
+	if err == nil {
+		return &payloadRelease, false, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	payloadRelease = PayloadRelease{
+		ReleasePayloadID: payload.ID,
+		ProbeID:          probeID,
+		UserID:           payload.UserID,
+		ReleaseAt:        releaseAt,
+	}
+
+	err = db.Create(&payloadRelease).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &payloadRelease, true, nil
+}
+
+// FindPayloadRelease returns the payload release with 'id', including its
+// release payload, the payload's attachments & contact
+func FindPayloadRelease(id interface{}) (*PayloadRelease, error) {
+	payloadRelease := PayloadRelease{}
+
+	err := db.Preload("ReleasePayload.Attachments").Preload("ReleasePayload.Contact").
+		First(&payloadRelease, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &payloadRelease, nil
+}
+
+// FetchReleasePayloadsForUser returns all of the user with 'userID's release payloads
+func FetchReleasePayloadsForUser(userID uint) ([]ReleasePayload, error) {
+	payloads := []ReleasePayload{}
+
+	err := db.Order("id asc").Find(&payloads, "user_id = ?", userID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return payloads, nil
+}
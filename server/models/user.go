@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Daskott/kronus/server/auth"
 	"gorm.io/gorm"
@@ -44,8 +45,12 @@ type User struct {
 
 	// These only exist to create the db constraints.
 	// Use helper functions to fetch data instead e.g. FetchContacts
-	Contacts []Contact `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	Probes   []Probe   `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Contacts        []Contact        `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Probes          []Probe          `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	EscalationSteps []EscalationStep `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ProbeSchedules  []ProbeSchedule  `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ReleasePayloads []ReleasePayload `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Webhooks        []Webhook        `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
 
 // DisableProbe turns off probe for user & cancels all pending probes
@@ -83,8 +88,15 @@ func (user *User) CancelAllPendingProbes() error {
 			probeIDs = append(probeIDs, probe.ID)
 		}
 
-		return db.Model(&Probe{}).
+		err = db.Model(&Probe{}).
 			Where("id IN ?", probeIDs).Update("probe_status_id", cancelledStatus.ID).Error
+		if err != nil {
+			return err
+		}
+
+		for _, probeID := range probeIDs {
+			publishProbeStatusEvent(probeID, CANCELLED_PROBE)
+		}
 	}
 
 	return nil
@@ -124,6 +136,61 @@ func (user *User) UpdateProbSettings(data map[string]interface{}) error {
 	return db.Find(&user.ProbeSettings, "user_id = ?", user.ID).Error
 }
 
+// SetProbePins hashes & saves the user's pins for responding to probes.
+// Only the pins provided are updated, an empty pin keeps the existing one.
+func (user *User) SetProbePins(safePin, duressPin string) error {
+	var err error
+	data := make(map[string]interface{})
+
+	if safePin != "" {
+		if data["safe_pin"], err = auth.HashPassword(safePin); err != nil {
+			return err
+		}
+	}
+
+	if duressPin != "" {
+		if data["duress_pin"], err = auth.HashPassword(duressPin); err != nil {
+			return err
+		}
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	return user.UpdateProbSettings(data)
+}
+
+// ClearProbePins removes the user's pins of type 'pinTypes' i.e. SAFE_PIN or DURESS_PIN
+func (user *User) ClearProbePins(pinTypes ...string) error {
+	data := make(map[string]interface{})
+	for _, pinType := range pinTypes {
+		data[pinType+"_pin"] = ""
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	return user.UpdateProbSettings(data)
+}
+
+// Snooze pauses the user's liveliness probes from 'startsAt' till 'endsAt'
+func (user *User) Snooze(startsAt, endsAt time.Time) error {
+	return user.UpdateProbSettings(map[string]interface{}{
+		"snooze_starts_at": startsAt,
+		"snooze_ends_at":   endsAt,
+	})
+}
+
+// LiftSnooze removes any snooze on the user's liveliness probes
+func (user *User) LiftSnooze() error {
+	return user.UpdateProbSettings(map[string]interface{}{
+		"snooze_starts_at": nil,
+		"snooze_ends_at":   nil,
+	})
+}
+
 func (user *User) IsAdmin() (bool, error) {
 	if user.RoleID == 0 {
 		return false, nil
@@ -192,7 +259,21 @@ func (user *User) UpdateContact(contactID string, data map[string]interface{}) (
 }
 
 func (user *User) DeleteContact(id interface{}) error {
-	return db.Where("user_id = ?", user.ID).Delete(&Contact{}, id).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Remove contact from the user's escalation policy
+		err := tx.Where("user_id = ? AND contact_id = ?", user.ID, id).Delete(&EscalationStep{}).Error
+		if err != nil {
+			return err
+		}
+
+		// Release payloads can't be released without their contact
+		err = deleteReleasePayloads(tx, "user_id = ? AND contact_id = ?", user.ID, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&Contact{}, id).Error
+	})
 }
 
 func (user *User) EmergencyContact() (*Contact, error) {
@@ -216,6 +297,17 @@ func (user *User) LastProbe() (*Probe, error) {
 	return &probe, nil
 }
 
+// FindProbe returns the user's probe with 'id', along with its status
+func (user *User) FindProbe(id interface{}) (*Probe, error) {
+	probe := Probe{}
+	err := db.Preload("ProbeStatus").Where("user_id = ?", user.ID).First(&probe, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &probe, nil
+}
+
 func FindProbeSettings(userID interface{}) (*ProbeSetting, error) {
 	probeSetting := ProbeSetting{}
 	err := db.First(&probeSetting, "user_id = ?", userID).Error
@@ -272,8 +364,38 @@ func CreateUser(user *User) error {
 	return err
 }
 
+// DeleteUser deletes the user with 'id' & everything that belongs to them. Foreign keys aren't enforced
+// by sqlite, so they're deleted here. Otherwise a new user given the same id, would inherit them.
 func DeleteUser(id interface{}) error {
-	return db.Delete(&User{}, id).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := deleteReleasePayloads(tx, "user_id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		userWebhooks := tx.Model(&Webhook{}).Select("id").Where("user_id = ?", id)
+		err = tx.Where("webhook_id IN (?)", userWebhooks).Delete(&WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+
+		userProbes := tx.Model(&Probe{}).Select("id").Where("user_id = ?", id)
+		err = tx.Where("probe_id IN (?)", userProbes).Delete(&EmergencyProbe{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&Webhook{}, &Probe{}, &ProbeSchedule{}, &EscalationStep{}, &Contact{}, &ProbeSetting{},
+		} {
+			err = tx.Where("user_id = ?", id).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&User{}, id).Error
+	})
 }
 
 func AtLeastOneUserExists() (bool, error) {
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// The most webhooks a user (or the admins) can have
+const MAX_WEBHOOKS = 10
+
+var ErrMaxWebhooks = errors.New("already have the max no. of webhooks")
+
+// Webhook is a url that receives signed POSTs for events e.g. 'probe.sent'.
+// A webhook with no user receives events for all users, and can only be managed by admins.
+type Webhook struct {
+	BaseModel
+	UserID *uint         `json:"user_id"`
+	Url    string        `json:"url" gorm:"not null"`
+	Events WebhookEvents `json:"events" gorm:"not null"`
+	Active bool          `json:"active"`
+
+	// Used to sign each delivery. It's only ever returned when the webhook is created.
+	Secret string `json:"-" gorm:"not null"`
+
+	Deliveries []WebhookDelivery `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// WebhookDelivery records a single attempt at delivering an event to a webhook
+type WebhookDelivery struct {
+	BaseModel
+	WebhookID uint `json:"webhook_id" gorm:"index;not null"`
+
+	// Shared by every attempt at delivering the same event
+	DeliveryID   string `json:"delivery_id" gorm:"index;not null"`
+	Event        string `json:"event"`
+	Payload      string `json:"payload"`
+	Attempt      int    `json:"attempt"`
+	StatusCode   int    `json:"status_code"`
+	Error        string `json:"error,omitempty"`
+	Successful   bool   `json:"successful"`
+	DurationInMs int64  `json:"duration_in_ms"`
+}
+
+// WebhookEvents are the event types a webhook is subscribed to.
+// They're stored as a comma separated list.
+type WebhookEvents []string
+
+func (WebhookEvents) GormDataType() string {
+	return "string"
+}
+
+func (webhookEvents WebhookEvents) Value() (driver.Value, error) {
+	return strings.Join(webhookEvents, ","), nil
+}
+
+func (webhookEvents *WebhookEvents) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unable to scan %T into WebhookEvents", value)
+	}
+
+	*webhookEvents = WebhookEvents{}
+	if raw != "" {
+		*webhookEvents = strings.Split(raw, ",")
+	}
+
+	return nil
+}
+
+// Includes returns true if 'eventType' is one of the events
+func (webhookEvents WebhookEvents) Includes(eventType string) bool {
+	for _, event := range webhookEvents {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (webhook *Webhook) Update(data map[string]interface{}) error {
+	return db.Model(webhook).Updates(data).Error
+}
+
+// CreateWebhook creates 'webhook' for the user with 'userID', or for all users if 'userID' is nil
+func CreateWebhook(userID *uint, webhook *Webhook) error {
+	var total int64
+
+	err := webhooksFor(db.Model(&Webhook{}), userID).Count(&total).Error
+	if err != nil {
+		return err
+	}
+
+	if total >= MAX_WEBHOOKS {
+		return ErrMaxWebhooks
+	}
+
+	webhook.UserID = userID
+	return db.Create(webhook).Error
+}
+
+// FetchWebhooks returns the webhooks for the user with 'userID', or the ones for all users if 'userID' is nil
+func FetchWebhooks(userID *uint) ([]Webhook, error) {
+	webhooks := []Webhook{}
+
+	err := webhooksFor(db.Order("id asc"), userID).Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// FindWebhook returns the webhook with 'id' for the user with 'userID', or for all users if 'userID' is nil
+func FindWebhook(userID *uint, id interface{}) (*Webhook, error) {
+	webhook := Webhook{}
+
+	err := webhooksFor(db, userID).First(&webhook, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+func DeleteWebhook(webhook *Webhook) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("webhook_id = ?", webhook.ID).Delete(&WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&Webhook{}, webhook.ID).Error
+	})
+}
+
+// ActiveWebhooksForEvent returns the active webhooks subscribed to 'eventType',
+// for the user with 'userID' & for all users
+func ActiveWebhooksForEvent(eventType string, userID uint) ([]Webhook, error) {
+	webhooks := []Webhook{}
+
+	err := db.Where("active = true AND (user_id = ? OR user_id IS NULL)", userID).Find(&webhooks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := []Webhook{}
+	for _, webhook := range webhooks {
+		if webhook.Events.Includes(eventType) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+
+	return subscribed, nil
+}
+
+// FindWebhookByID returns the webhook with 'id', whichever user it belongs to
+func FindWebhookByID(id interface{}) (*Webhook, error) {
+	webhook := Webhook{}
+
+	err := db.First(&webhook, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// CreateWebhookDelivery records an attempt at delivering the event with 'deliveryID' to the webhook.
+// The attempt no. is set from the previous attempts for the same delivery.
+func CreateWebhookDelivery(delivery *WebhookDelivery) error {
+	var attempts int64
+
+	err := db.Model(&WebhookDelivery{}).Where("delivery_id = ?", delivery.DeliveryID).Count(&attempts).Error
+	if err != nil {
+		return err
+	}
+
+	delivery.Attempt = int(attempts) + 1
+	return db.Create(delivery).Error
+}
+
+// FetchWebhookDeliveries returns the delivery log for the webhook with 'webhookID', latest first
+func FetchWebhookDeliveries(webhookID uint, page int) ([]WebhookDelivery, *Paging, error) {
+	var total int64
+	deliveries := []WebhookDelivery{}
+
+	err := db.Model(&WebhookDelivery{}).Where("webhook_id = ?", webhookID).Count(&total).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = db.Scopes(paginate(page, MAX_PAGE_SIZE)).Order("id desc").
+		Find(&deliveries, "webhook_id = ?", webhookID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	return deliveries, newPaging(int64(page), MAX_PAGE_SIZE, total), nil
+}
+
+func webhooksFor(tx *gorm.DB, userID *uint) *gorm.DB {
+	if userID == nil {
+		return tx.Where("user_id IS NULL")
+	}
+	return tx.Where("user_id = ?", *userID)
+}
@@ -1,44 +1,90 @@
 package pbscheduler
 
 import (
+	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Daskott/kronus/server/events"
 	"github.com/Daskott/kronus/server/logger"
+	"github.com/Daskott/kronus/server/messenger"
 	"github.com/Daskott/kronus/server/models"
-	"github.com/Daskott/kronus/server/twilio"
 	"github.com/Daskott/kronus/server/work"
 	"gorm.io/gorm"
 )
 
 const (
-	SEND_LIVELINESS_PROBE_HANDLER   = "send_liveliness_probe"
-	SEND_FOLLOWUP_PROBE_HANDLER     = "send_followup_probe"
-	SEND_EMERGENCY_PROBE_HANDLER    = "send_emergency_probe"
-	ENQUEUE_FOLLOWUP_PROBES_HANDLER = "enqueue_followup_probes"
-	SEND_DYNAMIC_PROBE_HANDLER      = "send_dynamic_probe"
+	SEND_LIVELINESS_PROBE_HANDLER       = "send_liveliness_probe"
+	SEND_FOLLOWUP_PROBE_HANDLER         = "send_followup_probe"
+	SEND_EMERGENCY_PROBE_HANDLER        = "send_emergency_probe"
+	ENQUEUE_FOLLOWUP_PROBES_HANDLER     = "enqueue_followup_probes"
+	SEND_DYNAMIC_PROBE_HANDLER          = "send_dynamic_probe"
+	SEND_ESCALATION_STEP_HANDLER        = "send_escalation_step"
+	SEND_ACKNOWLEDGEMENT_NOTICE_HANDLER = "send_acknowledgement_notice"
+	LIFT_SNOOZE_HANDLER                 = "lift_snooze"
+	RELEASE_PAYLOAD_HANDLER             = "release_payload"
+)
+
+const (
+	CHECK_IN_EMAIL_SUBJECT         = "Kronus check in"
+	FOLLOWUP_EMAIL_SUBJECT         = "Kronus check in - follow up"
+	EMERGENCY_EMAIL_SUBJECT        = "Kronus emergency alert for %v"
+	CONTACT_NOTIFIED_EMAIL_SUBJECT = "Kronus reached out to your emergency contact"
+	ACKNOWLEDGEMENT_EMAIL_SUBJECT  = "Kronus emergency alert acknowledged"
+	SNOOZE_LIFTED_EMAIL_SUBJECT    = "Kronus snooze is over"
+	RELEASE_PAYLOAD_EMAIL_SUBJECT  = "A message from %v, sent by kronus"
 )
 
 var logg = logger.NewLogger()
 
+// Linker builds the links included in the messages sent out by the probe scheduler
+type Linker interface {
+	// CheckInLink returns the url a user can visit to respond to the probe with 'probeID'
+	CheckInLink(probeID uint) string
+
+	// AcknowledgementLink returns the url a contact can visit to acknowledge
+	// the emergency probe with 'emergencyProbeID'
+	AcknowledgementLink(emergencyProbeID uint) string
+}
+
+// Decrypter decrypts the release payloads' messages & attachments, which are encrypted at rest
+type Decrypter interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
 type ProbeScheduler struct {
 	workerPoolAdapter        *work.WorkerPoolAdapter
-	messageClient            *twilio.ClientWrapper
+	messageClient            messenger.Messenger
+	mailer                   messenger.Mailer
+	linker                   Linker
+	decrypter                Decrypter
 	followProbesCronSchedule string
 }
 
-// NewProbeScheduler creates new probe scheduler
+// NewProbeScheduler creates new probe scheduler.
+// 'mailer' is optional, and if nil, probes are only sent via 'msgClient'.
+// 'linker' is optional, and if nil, messages won't include check-in or acknowledgement links.
+// 'decrypter' is optional, and if nil, release payloads can't be released.
 func NewProbeScheduler(
 	workerPoolAdapter *work.WorkerPoolAdapter,
-	msgClient *twilio.ClientWrapper,
+	msgClient messenger.Messenger,
+	mailer messenger.Mailer,
+	linker Linker,
+	decrypter Decrypter,
 	followProbesCronSchedule string,
 ) (*ProbeScheduler, error) {
 	probeScheduler := ProbeScheduler{
 		followProbesCronSchedule: followProbesCronSchedule,
 		workerPoolAdapter:        workerPoolAdapter,
 		messageClient:            msgClient,
+		mailer:                   mailer,
+		linker:                   linker,
+		decrypter:                decrypter,
 	}
 
 	err := probeScheduler.registerWorkerHandlers()
@@ -49,25 +95,44 @@ func NewProbeScheduler(
 	return &probeScheduler, nil
 }
 
-// PeriodicallyPerfomProbe creates 'liveliness probe' cron jobs for user.
+// PeriodicallyPerfomProbe creates 'liveliness probe' cron jobs for user, in the user's time zone.
 // And when each cron is triggered, the job is sent to a job to be executed.
 func (pbs ProbeScheduler) PeriodicallyPerfomProbe(user models.User) error {
-	// Try updating the user's probe job schedule if one is already running
-	// Else add a new one to the the scheduler
-	err := pbs.workerPoolAdapter.UpdateJobScheduleByTag(probeName(user.ID), user.ProbeSettings.CronExpression)
-	if err == work.ErrJobNotFoundInCronSch {
-		err = pbs.workerPoolAdapter.PeriodicallyPerform(user.ProbeSettings.CronExpression, work.JobParams{
-			Name:    probeName(user.ID),
-			Handler: SEND_LIVELINESS_PROBE_HANDLER,
-			Args: map[string]interface{}{
-				"user_id":    user.ID,
-				"first_name": user.FirstName,
-				"last_name":  user.LastName,
-			},
-		})
-	}
+	// Replaces the user's probe job if one is already running,
+	// as the user's time zone may have changed
+	return pbs.workerPoolAdapter.PeriodicallyPerform(user.ProbeSettings.CronExpression, work.JobParams{
+		Name:     probeName(user.ID),
+		Handler:  SEND_LIVELINESS_PROBE_HANDLER,
+		Queue:    work.MESSAGES_QUEUE,
+		TimeZone: user.ProbeSettings.TimeZone,
+		Args: map[string]interface{}{
+			"user_id":    user.ID,
+			"first_name": user.FirstName,
+			"last_name":  user.LastName,
+		},
+	})
+}
+
+// PeriodicallyPerformProbeSchedule creates a 'liveliness probe' cron job for the user's probe 'schedule',
+// in the user's time zone.
+func (pbs ProbeScheduler) PeriodicallyPerformProbeSchedule(user models.User, schedule models.ProbeSchedule) error {
+	return pbs.workerPoolAdapter.PeriodicallyPerform(schedule.CronExpression, work.JobParams{
+		Name:     scheduledProbeName(schedule.ID),
+		Handler:  SEND_LIVELINESS_PROBE_HANDLER,
+		Queue:    work.MESSAGES_QUEUE,
+		TimeZone: user.ProbeSettings.TimeZone,
+		Args: map[string]interface{}{
+			"user_id":           user.ID,
+			"first_name":        user.FirstName,
+			"last_name":         user.LastName,
+			"probe_schedule_id": schedule.ID,
+		},
+	})
+}
 
-	return err
+// RemoveProbeSchedule removes the cron job for the probe 'schedule' from the scheduler
+func (pbs ProbeScheduler) RemoveProbeSchedule(schedule models.ProbeSchedule) {
+	pbs.workerPoolAdapter.RemovePeriodicJob(scheduledProbeName(schedule.ID))
 }
 
 // DisablePeriodicProbe removes probe from scheduler & disables probe in user settings
@@ -76,6 +141,63 @@ func (pbs ProbeScheduler) DisablePeriodicProbe(user *models.User) error {
 	return user.DisableLivlinessProbe()
 }
 
+// DisableAllPeriodicProbes removes all the user's probes from scheduler,
+// and disables probe in user settings as well as all the user's probe schedules
+func (pbs ProbeScheduler) DisableAllPeriodicProbes(user *models.User) error {
+	schedules, err := user.FetchProbeSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		pbs.RemoveProbeSchedule(schedule)
+	}
+
+	err = user.DisableProbeSchedules()
+	if err != nil {
+		return err
+	}
+
+	return pbs.DisablePeriodicProbe(user)
+}
+
+// Snooze pauses the user's liveliness probes & followups from 'startsAt' till 'endsAt'.
+// A job is scheduled to lift the snooze once it's over.
+func (pbs ProbeScheduler) Snooze(user *models.User, startsAt, endsAt time.Time) error {
+	err := user.Snooze(startsAt, endsAt)
+	if err != nil {
+		return err
+	}
+
+	// Any pending probe is no longer relevant, if the user is snoozing from now
+	if !startsAt.After(time.Now()) {
+		err = user.CancelAllPendingProbes()
+		if err != nil {
+			return err
+		}
+	}
+
+	return pbs.workerPoolAdapter.PerformIn(int(time.Until(endsAt).Seconds()), work.JobParams{
+		Name:    liftSnoozeName(user.ID, endsAt),
+		Handler: LIFT_SNOOZE_HANDLER,
+		Args: map[string]interface{}{
+			"user_id":        user.ID,
+			"snooze_ends_at": endsAt.Unix(),
+		},
+	})
+}
+
+// LiftSnooze removes any snooze on the user's liveliness probes,
+// and cancels pending probes sent before or during the snooze.
+func (pbs ProbeScheduler) LiftSnooze(user *models.User) error {
+	err := user.LiftSnooze()
+	if err != nil {
+		return err
+	}
+
+	return user.CancelAllPendingProbes()
+}
+
 // ScheduleProbes adds probes to cron scheduler,
 // as well as check-ins for possible followup probes
 func (pScheduler ProbeScheduler) ScheduleProbes() {
@@ -90,6 +212,65 @@ func (pScheduler ProbeScheduler) ScheduleProbes() {
 	}
 }
 
+// CatchUpMissedProbes sends a single liveliness probe to each user whose probes were due within 'window'
+// before now but weren't sent e.g. as the server was down, even if more than one of their probes was missed.
+// It must be called before the worker pool is started, so the probes' last runs haven't been updated.
+func (pbs ProbeScheduler) CatchUpMissedProbes(window time.Duration) error {
+	if window <= 0 {
+		return nil
+	}
+
+	missedRuns, err := pbs.workerPoolAdapter.MissedRuns(SEND_LIVELINESS_PROBE_HANDLER, window)
+	if err != nil {
+		return err
+	}
+
+	// Catch up the probe that was missed last, for each user
+	missedRunsByUser := make(map[string][]work.MissedRun)
+	for _, missedRun := range missedRuns {
+		userID := fmt.Sprint(missedRun.Job.Args["user_id"])
+		missedRunsByUser[userID] = append(missedRunsByUser[userID], missedRun)
+	}
+
+	for userID, userMissedRuns := range missedRunsByUser {
+		lastMissedRun := userMissedRuns[0]
+		missed := 0
+		for _, missedRun := range userMissedRuns {
+			missed += missedRun.Missed
+			if missedRun.MissedAt.After(lastMissedRun.MissedAt) {
+				lastMissedRun = missedRun
+			}
+		}
+
+		// Send the probe right away, instead of at a random time within the jitter window (if any)
+		jobArgs := lastMissedRun.Job.Args
+		jobArgs["send_at"] = time.Now().Unix()
+
+		err = pbs.workerPoolAdapter.Perform(work.JobParams{
+			Name:    catchUpProbeName(userID),
+			Handler: SEND_LIVELINESS_PROBE_HANDLER,
+			Queue:   work.MESSAGES_QUEUE,
+			Args:    jobArgs,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, missedRun := range userMissedRuns {
+			err = pbs.workerPoolAdapter.MarkAsCaughtUp(missedRun)
+			if err != nil {
+				return err
+			}
+		}
+
+		logg.Infof("Catching up liveliness probe for userID=%v, %v probe(s) missed, last due at %v (%v)",
+			userID, missed, lastMissedRun.MissedAt, lastMissedRun.PeriodicJob.Name)
+	}
+	logg.Infof("%v missed liveliness probe(s) caught up", len(missedRunsByUser))
+
+	return nil
+}
+
 // EmergencyProbeName returns the string used as tag for an emergency probe job name
 func EmergencyProbeName(userID interface{}) string {
 	return fmt.Sprintf("%v-%v", SEND_EMERGENCY_PROBE_HANDLER, userID)
@@ -111,6 +292,19 @@ func (pScheduler ProbeScheduler) initUsersPeriodicProbes() error {
 	}
 	logg.Infof("%v liveliness probe(s) cron scheduled", len(users))
 
+	schedules, usersByID, err := models.ActiveProbeSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		err = pScheduler.PeriodicallyPerformProbeSchedule(usersByID[schedule.UserID], schedule)
+		if err != nil {
+			return err
+		}
+	}
+	logg.Infof("%v liveliness probe schedule(s) cron scheduled", len(schedules))
+
 	return nil
 }
 
@@ -124,9 +318,10 @@ func (pbs ProbeScheduler) initPeriodicFollowupProbesEnqeuer() error {
 	})
 }
 
-func (pScheduler ProbeScheduler) enqueueFollowUpsForProbes(params map[string]interface{}) error {
+func (pScheduler ProbeScheduler) enqueueFollowUpsForProbes(ctx context.Context, params map[string]interface{}) error {
 	noOfEmergencyProbeJobsQueued := 0
 	noOfFollowupProbeJobsQueued := 0
+	noOfProbesDeferred := 0
 	probes, err := models.FetchPendingProbesWithElapsedWait()
 	if err != nil {
 		logg.Error(err)
@@ -138,6 +333,17 @@ func (pScheduler ProbeScheduler) enqueueFollowUpsForProbes(params map[string]int
 		jobArgs["user_id"] = probe.UserID
 		jobArgs["probe_id"] = probe.ID
 
+		deferred, err := pScheduler.deferProbeForQuietHours(&probe)
+		if err != nil {
+			logg.Error(err)
+			continue
+		}
+
+		if deferred {
+			noOfProbesDeferred++
+			continue
+		}
+
 		// if max retries is exceeded, send emergency probe
 		if probe.RetryCount >= probe.MaxRetries {
 			jobArgs["probe_status"] = models.UNAVAILABLE_PROBE
@@ -145,6 +351,7 @@ func (pScheduler ProbeScheduler) enqueueFollowUpsForProbes(params map[string]int
 			err = pScheduler.workerPoolAdapter.Perform(work.JobParams{
 				Name:    EmergencyProbeName(probe.UserID),
 				Handler: SEND_EMERGENCY_PROBE_HANDLER,
+				Queue:   work.MESSAGES_QUEUE,
 				Args:    jobArgs,
 			})
 
@@ -159,6 +366,7 @@ func (pScheduler ProbeScheduler) enqueueFollowUpsForProbes(params map[string]int
 		err = pScheduler.workerPoolAdapter.Perform(work.JobParams{
 			Name:    followupProbeName(probe.UserID),
 			Handler: SEND_FOLLOWUP_PROBE_HANDLER,
+			Queue:   work.MESSAGES_QUEUE,
 			Args:    jobArgs,
 		})
 
@@ -169,31 +377,141 @@ func (pScheduler ProbeScheduler) enqueueFollowUpsForProbes(params map[string]int
 		noOfFollowupProbeJobsQueued++
 	}
 
-	logg.Infof("%v pending probe(s), %v emergency probe job(s) queued, %v followup probe job(s) queued",
-		len(probes), noOfEmergencyProbeJobsQueued, noOfFollowupProbeJobsQueued)
+	logg.Infof("%v pending probe(s), %v emergency probe job(s) queued, %v followup probe job(s) queued, "+
+		"%v deferred for quiet hours",
+		len(probes), noOfEmergencyProbeJobsQueued, noOfFollowupProbeJobsQueued, noOfProbesDeferred)
 
 	return nil
 }
 
-func (pScheduler ProbeScheduler) sendMessage(to, msg string) error {
-	return pScheduler.messageClient.SendMessage(to, msg)
+// deferProbeForQuietHours pauses the wait clock of a probe whose user is in quiet hours, until the quiet hours end.
+// i.e. the probe's 'updated_at' is pushed forward by how long the probe's wait overlaps with quiet hours.
+// Emergency probes aren't deferred, if the user allows them to bypass quiet hours.
+// It returns true if the probe was deferred.
+func (pScheduler ProbeScheduler) deferProbeForQuietHours(probe *models.Probe) (bool, error) {
+	user, err := models.FindUserBy("id", probe.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	start, end, inQuietHours := user.ProbeSettings.QuietHoursAt(time.Now(), pScheduler.UserLocation(user))
+	if !inQuietHours {
+		return false, nil
+	}
+
+	if probe.RetryCount >= probe.MaxRetries && user.ProbeSettings.EmergencyBypassesQuietHours {
+		return false, nil
+	}
+
+	pausedFrom := start
+	if probe.UpdatedAt.After(start) {
+		pausedFrom = probe.UpdatedAt
+	}
+
+	return true, probe.Update(map[string]interface{}{"updated_at": probe.UpdatedAt.Add(end.Sub(pausedFrom))})
+}
+
+// UserLocation returns the time zone the user's probes are scheduled in
+func (pScheduler ProbeScheduler) UserLocation(user *models.User) *time.Location {
+	return user.ProbeSettings.Location(pScheduler.workerPoolAdapter.Location())
+}
+
+func (pScheduler ProbeScheduler) sendMessage(ctx context.Context, to, msg string) error {
+	return pScheduler.messageClient.SendMessage(ctx, to, msg)
+}
+
+// sendEmail sends 'msg' as an email if a mailer is configured.
+// Errors are only logged, so a failed email never causes an already sent sms to be retried.
+func (pScheduler ProbeScheduler) sendEmail(ctx context.Context, to, subject, msg string) {
+	if pScheduler.mailer == nil || to == "" {
+		return
+	}
+
+	email, err := messenger.NewEmail(to, subject, msg)
+	if err != nil {
+		logg.Error(err)
+		return
+	}
+
+	if err := pScheduler.mailer.SendEmail(ctx, email); err != nil {
+		logg.Error(err)
+	}
+}
+
+// sendProbeMessage sends the probe 'msg' to the user, with the probe's check-in link (if any)
+func (pScheduler ProbeScheduler) sendProbeMessage(ctx context.Context, user *models.User, probe *models.Probe, subject, msg string) error {
+	if pScheduler.linker != nil {
+		msg = fmt.Sprintf("%v\nOr check in here: %v", msg, pScheduler.linker.CheckInLink(probe.ID))
+	}
+
+	err := pScheduler.sendMessage(ctx, user.PhoneNumber, msg)
+	if err != nil {
+		return err
+	}
+	pScheduler.sendEmail(ctx, user.Email, subject, msg)
+
+	return nil
+}
+
+// deleteUnsentProbe removes a probe whose message failed to send,
+// so it doesn't block the probe job from being retried
+func (pScheduler ProbeScheduler) deleteUnsentProbe(probe *models.Probe) {
+	if err := probe.Delete(); err != nil {
+		logg.Error(err)
+	}
 }
 
 // ---------------------------------------------------------------------------------//
 // Tasks
 // --------------------------------------------------------------------------------//
 
-func (pScheduler ProbeScheduler) sendLivelinessProbe(params map[string]interface{}) error {
+func (pScheduler ProbeScheduler) sendLivelinessProbe(ctx context.Context, params map[string]interface{}) error {
+	var schedule *models.ProbeSchedule
+
 	user, err := models.FindUserBy("id", params["user_id"])
 	if err != nil {
 		return err
 	}
 
-	if !user.ProbeSettings.Active {
+	// Probes for a probe schedule only depend on the schedule being active
+	if params["probe_schedule_id"] != nil {
+		schedule, err = user.FindProbeSchedule(params["probe_schedule_id"])
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logg.Infof("skipping liveliness probe for userID=%v, probe scheduleID=%v no longer exists",
+				params["user_id"], params["probe_schedule_id"])
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !schedule.Active {
+			logg.Infof("skipping liveliness probe for userID=%v, probe scheduleID=%v is currently disabled",
+				params["user_id"], schedule.ID)
+			return nil
+		}
+	} else if !user.ProbeSettings.Active {
 		logg.Infof("skipping liveliness probe for userID=%v, it's currently disabled", params["user_id"])
 		return nil
 	}
 
+	if user.ProbeSettings.IsSnoozed(time.Now()) {
+		logg.Infof("skipping liveliness probe for userID=%v, it's snoozed until %v",
+			params["user_id"], user.ProbeSettings.SnoozeEndsAt)
+		return nil
+	}
+
+	// Pick a random time within the jitter window (if any) to send the probe, when triggered by the cron schedule
+	jitterWindowInMinutes := user.ProbeSettings.JitterWindowInMinutes
+	if schedule != nil {
+		jitterWindowInMinutes = schedule.JitterWindowInMinutes
+	}
+
+	if jitterWindowInMinutes > 0 && params["send_at"] == nil {
+		return pScheduler.jitterLivelinessProbe(params, jitterWindowInMinutes)
+	}
+
 	lastProbe, err := user.LastProbe()
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		logg.Error(err)
@@ -213,43 +531,98 @@ func (pScheduler ProbeScheduler) sendLivelinessProbe(params map[string]interface
 		}
 	}
 
+	// Create record of initial probe msg sent to usser in db,
+	// before sending the msg so it can include the probe's check-in link
+	var probe *models.Probe
+	if schedule != nil {
+		probe, err = models.CreateScheduledProbe(schedule)
+	} else {
+		probe, err = models.CreateProbe(user.ID, user.ProbeSettings.WaitTimeInMinutes, user.ProbeSettings.MaxRetries)
+	}
+	if err != nil {
+		logg.Error(err)
+		return err
+	}
+
 	msg := fmt.Sprintf("Hi %v,\n"+
 		"Just your friendly check in 🙂. Are you good ? (Y/N)",
 		strings.Title(params["first_name"].(string)))
-	err = pScheduler.sendMessage(user.PhoneNumber, msg)
+	if schedule != nil {
+		msg = fmt.Sprintf("Hi %v,\n"+
+			"Just your friendly '%v' check in 🙂. Are you good ? (Y/N)",
+			strings.Title(params["first_name"].(string)), schedule.Name)
+	}
+
+	err = pScheduler.sendProbeMessage(ctx, user, probe, CHECK_IN_EMAIL_SUBJECT, msg)
 	if err != nil {
 		logg.Error(err)
+		pScheduler.deleteUnsentProbe(probe)
 		return err
 	}
 
-	// Create record of initial probe msg sent to usser in db
-	err = models.CreateProbe(user.ID, user.ProbeSettings.WaitTimeInMinutes, user.ProbeSettings.MaxRetries)
+	events.Publish(events.PROBE_SENT, user.ID, probe)
+	return nil
+}
+
+// jitterLivelinessProbe schedules the liveliness probe to be sent at a random time within the jitter window.
+// The chosen time is persisted with the scheduled job i.e. as its 'add_to_queue_at' & 'send_at' arg,
+// so it isn't re-rolled if the server restarts.
+func (pScheduler ProbeScheduler) jitterLivelinessProbe(params map[string]interface{}, jitterWindowInMinutes int) error {
+	delay, err := rand.Int(rand.Reader, big.NewInt(int64(jitterWindowInMinutes*60)))
 	if err != nil {
-		logg.Error(err)
 		return err
 	}
 
-	return nil
+	sendAt := time.Now().Add(time.Duration(delay.Int64()) * time.Second)
+	jobArgs := map[string]interface{}{"send_at": sendAt.Unix()}
+	for key, value := range params {
+		jobArgs[key] = value
+	}
+
+	name := probeName(params["user_id"])
+	if params["probe_schedule_id"] != nil {
+		name = scheduledProbeName(params["probe_schedule_id"])
+	}
+
+	logg.Infof("jittering liveliness probe for userID=%v, it'll be sent at %v", params["user_id"], sendAt)
+
+	return pScheduler.workerPoolAdapter.PerformAt(sendAt, work.JobParams{
+		Name:    fmt.Sprintf("%v-%v", name, sendAt.Unix()),
+		Handler: SEND_LIVELINESS_PROBE_HANDLER,
+		Queue:   work.MESSAGES_QUEUE,
+		Args:    jobArgs,
+	})
 }
 
-func (pScheduler ProbeScheduler) sendFollowupForProbe(params map[string]interface{}) error {
+func (pScheduler ProbeScheduler) sendFollowupForProbe(ctx context.Context, params map[string]interface{}) error {
 	user, err := models.FindUserBy("id", params["user_id"])
 	if err != nil {
 		return err
 	}
 
-	if !user.ProbeSettings.Active {
-		logg.Infof("skipping followup probe for userID=%v, probe is currently disabled", params["user_id"])
-		return nil
+	probe, err := models.FindProbe(params["probe_id"])
+	if err != nil {
+		return err
 	}
 
-	probe, err := models.FindProbe(params["probe_id"])
+	active, err := isProbeActive(user, probe)
 	if err != nil {
 		return err
 	}
 
+	if !active {
+		logg.Infof("skipping followup probe for userID=%v, probe is currently disabled", params["user_id"])
+		return nil
+	}
+
+	if user.ProbeSettings.IsSnoozed(time.Now()) {
+		logg.Infof("skipping followup probe for userID=%v, it's snoozed until %v",
+			params["user_id"], user.ProbeSettings.SnoozeEndsAt)
+		return nil
+	}
+
 	msg := "You good ?? (Y/N)"
-	err = pScheduler.sendMessage(user.PhoneNumber, msg)
+	err = pScheduler.sendProbeMessage(ctx, user, probe, FOLLOWUP_EMAIL_SUBJECT, msg)
 	if err != nil {
 		return err
 	}
@@ -260,22 +633,120 @@ func (pScheduler ProbeScheduler) sendFollowupForProbe(params map[string]interfac
 		return err
 	}
 
+	events.Publish(events.PROBE_SENT, user.ID, probe)
 	return nil
 }
 
-func (pScheduler ProbeScheduler) sendEmergencyProbe(params map[string]interface{}) error {
+func (pScheduler ProbeScheduler) sendEmergencyProbe(ctx context.Context, params map[string]interface{}) error {
 	user, err := models.FindUserBy("id", params["user_id"])
 	if err != nil {
 		return err
 	}
 
-	// Set user liveliness probe status to params["probe_status"] i.e. 'unavailable' or 'bad'
-	err = models.SetProbeStatus(params["probe_id"], params["probe_status"].(string))
+	probe, err := models.FindProbe(params["probe_id"])
+	if err != nil {
+		return err
+	}
+
+	// Set user liveliness probe status to params["probe_status"] i.e. 'unavailable' or 'bad'.
+	// A probe under duress is left as 'good', so anyone watching the user's probes is none the wiser.
+	if !probe.Duress {
+		err = models.SetProbeStatus(params["probe_id"], params["probe_status"].(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	steps, err := user.EscalationChain()
+	if err != nil {
+		return err
+	}
+
+	if len(steps) == 0 {
+		return fmt.Errorf("no emergency contact or escalation policy found for userID=%v", user.ID)
+	}
+
+	// Don't fail the job, so the escalation chain isn't held up by the release payloads
+	err = pScheduler.schedulePayloadReleases(user, params["probe_id"])
+	if err != nil {
+		logg.Error(err)
+	}
+
+	jobArgs := map[string]interface{}{
+		"user_id":      user.ID,
+		"probe_id":     params["probe_id"],
+		"probe_status": params["probe_status"],
+		"position":     0,
+	}
+
+	// Start the escalation chain i.e. reach out to the first contact,
+	// unless they're only meant to be contacted after a delay
+	if steps[0].DelayInMinutes > 0 {
+		return pScheduler.workerPoolAdapter.PerformIn(steps[0].DelayInMinutes*60, work.JobParams{
+			Name:    escalationStepName(params["probe_id"], 0),
+			Handler: SEND_ESCALATION_STEP_HANDLER,
+			Queue:   work.MESSAGES_QUEUE,
+			Args:    jobArgs,
+		})
+	}
+
+	return pScheduler.reachOutToEscalationContact(ctx, user, steps, jobArgs)
+}
+
+func (pScheduler ProbeScheduler) sendEscalationStep(ctx context.Context, params map[string]interface{}) error {
+	user, err := models.FindUserBy("id", params["user_id"])
+	if err != nil {
+		return err
+	}
+
+	steps, err := user.EscalationChain()
+	if err != nil {
+		return err
+	}
+
+	return pScheduler.reachOutToEscalationContact(ctx, user, steps, params)
+}
+
+// reachOutToEscalationContact messages the contact in the escalation step at params["position"],
+// and schedules the next step in the chain (if any).
+func (pScheduler ProbeScheduler) reachOutToEscalationContact(
+	ctx context.Context,
+	user *models.User,
+	steps []models.EscalationStep,
+	params map[string]interface{},
+) error {
+	position, err := strconv.Atoi(fmt.Sprint(params["position"]))
+	if err != nil {
+		return err
+	}
+
+	if position >= len(steps) {
+		logg.Infof("skipping escalation step %v for probeID=%v, the escalation policy only has %v step(s)",
+			position, params["probe_id"], len(steps))
+		return nil
+	}
+
+	// Stop the escalation chain, once a contact has acknowledged the emergency probe
+	acknowledgement, err := models.ProbeAcknowledgement(params["probe_id"])
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if acknowledgement != nil {
+		logg.Infof("skipping escalation step %v for probeID=%v, it was acknowledged by contactID=%v",
+			position, params["probe_id"], acknowledgement.ContactID)
+		return nil
+	}
+
+	probe, err := models.FindProbe(params["probe_id"])
 	if err != nil {
 		return err
 	}
 
-	emergencyContact, err := user.EmergencyContact()
+	emergencyContact := steps[position].Contact
+
+	// Record emregency probe before sending it out, so the message can include its acknowledgement link
+	emergencyProbe, err := models.CreateEmergencyProbe(params["probe_id"], emergencyContact.ID, position)
 	if err != nil {
 		return err
 	}
@@ -299,49 +770,318 @@ func (pScheduler ProbeScheduler) sendEmergencyProbe(params map[string]interface{
 			strings.Title(user.FirstName))
 	}
 
+	// The user responded with their duress pin, so they might not be able to talk freely
+	if probe.Duress {
+		message = fmt.Sprintf(
+			"Hi %v,\n"+
+				"you're getting this message becasue you're %v's emergency contact.\n"+
+				"%v just silently signalled they're in danger & might not be able to talk freely.\n"+
+				"Please check on them discreetly ASAP, and don't mention this message to them.",
+			strings.Title(emergencyContact.FirstName), strings.Title(user.FirstName),
+			strings.Title(user.FirstName))
+	}
+
+	message += fmt.Sprintf("\nReply ACK to let %v & their other contacts know you're on it.", strings.Title(user.FirstName))
+	if pScheduler.linker != nil {
+		message += fmt.Sprintf(" Or visit: %v", pScheduler.linker.AcknowledgementLink(emergencyProbe.ID))
+	}
+
 	// Send message to emergency contact
-	err = pScheduler.sendMessage(emergencyContact.PhoneNumber, message)
+	err = pScheduler.sendMessage(ctx, emergencyContact.PhoneNumber, message)
 	if err != nil {
+		// Remove the emergency probe, as it was never sent out
+		if err := emergencyProbe.Delete(); err != nil {
+			logg.Error(err)
+		}
 		return err
 	}
+	pScheduler.sendEmail(ctx, emergencyContact.Email,
+		fmt.Sprintf(EMERGENCY_EMAIL_SUBJECT, strings.Title(user.FirstName)), message)
+
+	// Don't let anyone watching the user's phone or events know, for a probe under duress.
+	// Their probes are also kept on, as they would be for a 'good' probe.
+	if !probe.Duress {
+		events.Publish(events.EMERGENCY_SENT, user.ID, emergencyProbe)
+
+		// The user's probes are only disabled once a contact has actually been reached out to
+		if position == 0 {
+			err = pScheduler.DisableAllPeriodicProbes(user)
+			if err != nil {
+				logg.Error(err)
+			}
+		}
+
+		message = fmt.Sprintf("Also reached out to %v.", strings.Title(emergencyContact.FirstName))
+		if position == 0 {
+			message = fmt.Sprintf(
+				"Reached out to %v. Liveliness probe is now disabled. You can always turn this back on via your kronus API.",
+				strings.Title(emergencyContact.FirstName),
+			)
+		}
+		err = pScheduler.sendMessage(ctx, user.PhoneNumber, message)
+		if err != nil {
+			logg.Error(err)
+		}
+		pScheduler.sendEmail(ctx, user.Email, CONTACT_NOTIFIED_EMAIL_SUBJECT, message)
+	}
+
+	// Schedule the next step in the escalation chain
+	if position+1 < len(steps) {
+		delayInMinutes := steps[position+1].DelayInMinutes - steps[position].DelayInMinutes
+		if delayInMinutes < 0 {
+			delayInMinutes = 0
+		}
+
+		err = pScheduler.workerPoolAdapter.PerformIn(delayInMinutes*60, work.JobParams{
+			Name:    escalationStepName(params["probe_id"], position+1),
+			Handler: SEND_ESCALATION_STEP_HANDLER,
+			Queue:   work.MESSAGES_QUEUE,
+			Args: map[string]interface{}{
+				"user_id":      user.ID,
+				"probe_id":     params["probe_id"],
+				"probe_status": params["probe_status"],
+				"position":     position + 1,
+			},
+		})
+		if err != nil {
+			logg.Error(err)
+		}
+	}
+
+	return nil
+}
 
-	// Record emregency probe sent out
-	err = models.CreateEmergencyProbe(params["probe_id"], emergencyContact.ID)
+// sendAcknowledgementNotice lets the user & all other contacts reached out to for the probe know,
+// that a contact has acknowledged the emergency probe
+func (pScheduler ProbeScheduler) sendAcknowledgementNotice(ctx context.Context, params map[string]interface{}) error {
+	acknowledgement, err := models.FindEmergencyProbe(params["emergency_probe_id"])
 	if err != nil {
-		logg.Error(err)
+		return err
 	}
 
-	err = pScheduler.DisablePeriodicProbe(user)
+	user, err := models.FindUserBy("id", params["user_id"])
 	if err != nil {
-		logg.Error(err)
+		return err
 	}
 
-	err = pScheduler.sendMessage(
-		user.PhoneNumber,
-		fmt.Sprintf(
-			"Reached out to %v. Liveliness probe is now disabled. You can always turn this back on via your kronus API.",
-			strings.Title(emergencyContact.FirstName),
-		),
-	)
+	emergencyProbes, err := models.FetchEmergencyProbes(acknowledgement.ProbeID)
 	if err != nil {
-		logg.Error(err)
+		return err
+	}
+
+	probe, err := models.FindProbe(acknowledgement.ProbeID)
+	if err != nil {
+		return err
+	}
+
+	// Don't let anyone watching the user's phone know, for a probe under duress
+	if !probe.Duress {
+		message := fmt.Sprintf("%v got the alert and is reaching out to you.", strings.Title(acknowledgement.Contact.FirstName))
+		err = pScheduler.sendMessage(ctx, user.PhoneNumber, message)
+		if err != nil {
+			return err
+		}
+		pScheduler.sendEmail(ctx, user.Email, ACKNOWLEDGEMENT_EMAIL_SUBJECT, message)
+	}
+
+	for _, emergencyProbe := range emergencyProbes {
+		if emergencyProbe.ContactID == acknowledgement.ContactID || emergencyProbe.Contact == nil {
+			continue
+		}
+
+		message := fmt.Sprintf("Hi %v,\n%v got the alert and is reaching out to %v. No further action is needed from you.",
+			strings.Title(emergencyProbe.Contact.FirstName), strings.Title(acknowledgement.Contact.FirstName),
+			strings.Title(user.FirstName))
+
+		// Don't fail the job, as the user has already been notified
+		err = pScheduler.sendMessage(ctx, emergencyProbe.Contact.PhoneNumber, message)
+		if err != nil {
+			logg.Error(err)
+			continue
+		}
+		pScheduler.sendEmail(ctx, emergencyProbe.Contact.Email, ACKNOWLEDGEMENT_EMAIL_SUBJECT, message)
 	}
 
 	return nil
 }
 
-func (pScheduler ProbeScheduler) sendDynamicProbe(params map[string]interface{}) error {
+// liftSnooze lifts the user's snooze once it's over & lets them know their probes are back on.
+// Snoozes that were changed or lifted after the job was scheduled are skipped.
+func (pScheduler ProbeScheduler) liftSnooze(ctx context.Context, params map[string]interface{}) error {
 	user, err := models.FindUserBy("id", params["user_id"])
 	if err != nil {
 		return err
 	}
 
-	msg := fmt.Sprintf("Hi %v,\n"+
-		"You asked to check on you 🙂. Are you good ? (Y/N)",
-		strings.Title(params["first_name"].(string)))
-	err = pScheduler.sendMessage(user.PhoneNumber, msg)
+	snoozeEndsAt := user.ProbeSettings.SnoozeEndsAt
+	if snoozeEndsAt == nil || fmt.Sprint(snoozeEndsAt.Unix()) != fmt.Sprint(params["snooze_ends_at"]) {
+		logg.Infof("skipping lifting snooze for userID=%v, it was changed or already lifted", params["user_id"])
+		return nil
+	}
+
+	err = pScheduler.LiftSnooze(user)
+	if err != nil {
+		return err
+	}
+
+	message := "Welcome back! Your kronus snooze is over."
+	if user.ProbeSettings.Active {
+		message = "Welcome back! Your kronus snooze is over, and liveliness probes are back on."
+	}
+
+	err = pScheduler.sendMessage(ctx, user.PhoneNumber, message)
+	if err != nil {
+		return err
+	}
+	pScheduler.sendEmail(ctx, user.Email, SNOOZE_LIFTED_EMAIL_SUBJECT, message)
+
+	return nil
+}
+
+// schedulePayloadReleases schedules each of the user's release payloads to be released
+// after their delay, for the probe with 'probeID'
+func (pScheduler ProbeScheduler) schedulePayloadReleases(user *models.User, probeID interface{}) error {
+	payloads, err := models.FetchReleasePayloadsForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(fmt.Sprint(probeID))
+	if err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		releaseAt := time.Now().Add(time.Duration(payload.DelayInMinutes) * time.Minute)
+		payloadRelease, created, err := models.CreatePayloadRelease(&payload, uint(id), releaseAt)
+		if err != nil {
+			return err
+		}
+
+		// The payload was already scheduled for the probe e.g. the emergency probe job was retried
+		if !created {
+			continue
+		}
+
+		err = pScheduler.workerPoolAdapter.PerformAt(releaseAt, work.JobParams{
+			Name:    releasePayloadName(payloadRelease.ID),
+			Handler: RELEASE_PAYLOAD_HANDLER,
+			Queue:   work.MESSAGES_QUEUE,
+			Args: map[string]interface{}{
+				"user_id":            user.ID,
+				"payload_release_id": payloadRelease.ID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releasePayload decrypts the release payload & sends it to its contact,
+// unless the user checked in & cancelled the release in the meantime
+func (pScheduler ProbeScheduler) releasePayload(ctx context.Context, params map[string]interface{}) error {
+	payloadRelease, err := models.FindPayloadRelease(params["payload_release_id"])
+
+	// The payload or its release was deleted, so there's nothing left to release
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logg.Infof("skipping payload release for payloadReleaseID=%v, it no longer exists", params["payload_release_id"])
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !payloadRelease.IsPending() {
+		logg.Infof("skipping payload release for payloadReleaseID=%v, it was cancelled or already released",
+			payloadRelease.ID)
+		return nil
+	}
+
+	if pScheduler.decrypter == nil {
+		return fmt.Errorf("unable to release payloadReleaseID=%v, no decrypter configured", payloadRelease.ID)
+	}
+
+	user, err := models.FindUserBy("id", params["user_id"])
+	if err != nil {
+		return err
+	}
+
+	payload := payloadRelease.ReleasePayload
+	contact := payload.Contact
+
+	plaintext, err := pScheduler.decrypter.Decrypt(payload.Message)
+	if err != nil {
+		return err
+	}
+
+	attachments := []messenger.Attachment{}
+	for _, attachment := range payload.Attachments {
+		content, err := pScheduler.decrypter.Decrypt(attachment.Content)
+		if err != nil {
+			return err
+		}
+
+		attachments = append(attachments, messenger.Attachment{
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			Content:     content,
+		})
+	}
+
+	message := fmt.Sprintf("Hi %v,\n%v asked kronus to pass this on to you, if they ever stopped checking in:\n\n%v",
+		strings.Title(contact.FirstName), strings.Title(user.FirstName), string(plaintext))
+
+	// The email is sent first, so the attachments are only mentioned in the sms once they've actually been sent
+	emailed := false
+	if pScheduler.mailer != nil {
+		email, err := messenger.NewEmail(contact.Email,
+			fmt.Sprintf(RELEASE_PAYLOAD_EMAIL_SUBJECT, strings.Title(user.FirstName)), message)
+		if err == nil {
+			email.Attachments = attachments
+			err = pScheduler.mailer.SendEmail(ctx, email)
+		}
+
+		// The attachments can only be sent by email, so retry the release if they weren't
+		if err != nil && len(attachments) > 0 {
+			return err
+		}
+
+		if err != nil {
+			logg.Error(err)
+		}
+		emailed = err == nil
+	} else if len(attachments) > 0 {
+		logg.Warnf("unable to send %v attachment(s) for payloadReleaseID=%v, email isn't enabled",
+			len(attachments), payloadRelease.ID)
+	}
+
+	if emailed && len(attachments) > 0 {
+		message += fmt.Sprintf("\n\n%v also left you %v attachment(s), which were sent to %v.",
+			strings.Title(user.FirstName), len(attachments), contact.Email)
+	}
+
+	err = pScheduler.sendMessage(ctx, contact.PhoneNumber, message)
+	if err != nil {
+		return err
+	}
+
+	// Don't fail the job, as the payload has already been sent
+	_, err = payloadRelease.MarkAsReleased()
 	if err != nil {
 		logg.Error(err)
+	}
+
+	logg.Infof("released payloadReleaseID=%v for userID=%v to contactID=%v", payloadRelease.ID, user.ID, contact.ID)
+	return nil
+}
+
+func (pScheduler ProbeScheduler) sendDynamicProbe(ctx context.Context, params map[string]interface{}) error {
+	user, err := models.FindUserBy("id", params["user_id"])
+	if err != nil {
 		return err
 	}
 
@@ -358,13 +1098,25 @@ func (pScheduler ProbeScheduler) sendDynamicProbe(params map[string]interface{})
 		logg.Warnf("Unabe to use 'max_retries' params: %v", err)
 	}
 
-	// Create record of probe msg sent to user in db
-	err = models.CreateProbe(user.ID, waitTimeInMinutes, maxRetries)
+	// Create record of probe msg sent to user in db,
+	// before sending the msg so it can include the probe's check-in link
+	probe, err := models.CreateProbe(user.ID, waitTimeInMinutes, maxRetries)
+	if err != nil {
+		logg.Error(err)
+		return err
+	}
+
+	msg := fmt.Sprintf("Hi %v,\n"+
+		"You asked to check on you 🙂. Are you good ? (Y/N)",
+		strings.Title(params["first_name"].(string)))
+	err = pScheduler.sendProbeMessage(ctx, user, probe, CHECK_IN_EMAIL_SUBJECT, msg)
 	if err != nil {
 		logg.Error(err)
+		pScheduler.deleteUnsentProbe(probe)
 		return err
 	}
 
+	events.Publish(events.PROBE_SENT, user.ID, probe)
 	return nil
 }
 
@@ -372,28 +1124,63 @@ func (pScheduler ProbeScheduler) sendDynamicProbe(params map[string]interface{})
 // Helper functions
 // --------------------------------------------------------------------------------//
 
+// emergencyHandlerOptions are for the handlers of jobs that reach out to emergency contacts,
+// which jump the queue & are retried sooner, and more often than other jobs if they fail
+var emergencyHandlerOptions = work.HandlerOptions{
+	Priority:    work.HIGHEST_PRIORITY,
+	MaxAttempts: 6,
+	Backoff: &work.BackoffPolicy{
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     2 * time.Minute,
+		Multiplier:      2,
+		Jitter:          0.2,
+	},
+}
+
 func (probeScheduler *ProbeScheduler) registerWorkerHandlers() error {
-	err := probeScheduler.workerPoolAdapter.Register(SEND_LIVELINESS_PROBE_HANDLER, probeScheduler.sendLivelinessProbe)
+	err := probeScheduler.workerPoolAdapter.RegisterContext(SEND_LIVELINESS_PROBE_HANDLER, probeScheduler.sendLivelinessProbe, work.HandlerOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = probeScheduler.workerPoolAdapter.RegisterContext(SEND_FOLLOWUP_PROBE_HANDLER, probeScheduler.sendFollowupForProbe, work.HandlerOptions{})
 	if err != nil {
 		return err
 	}
 
-	err = probeScheduler.workerPoolAdapter.Register(SEND_FOLLOWUP_PROBE_HANDLER, probeScheduler.sendFollowupForProbe)
+	err = probeScheduler.workerPoolAdapter.RegisterContext(SEND_EMERGENCY_PROBE_HANDLER, probeScheduler.sendEmergencyProbe,
+		emergencyHandlerOptions)
 	if err != nil {
 		return err
 	}
 
-	err = probeScheduler.workerPoolAdapter.Register(SEND_EMERGENCY_PROBE_HANDLER, probeScheduler.sendEmergencyProbe)
+	err = probeScheduler.workerPoolAdapter.RegisterContext(ENQUEUE_FOLLOWUP_PROBES_HANDLER, probeScheduler.enqueueFollowUpsForProbes, work.HandlerOptions{})
 	if err != nil {
 		return err
 	}
 
-	err = probeScheduler.workerPoolAdapter.Register(ENQUEUE_FOLLOWUP_PROBES_HANDLER, probeScheduler.enqueueFollowUpsForProbes)
+	err = probeScheduler.workerPoolAdapter.RegisterContext(SEND_DYNAMIC_PROBE_HANDLER, probeScheduler.sendDynamicProbe, work.HandlerOptions{})
 	if err != nil {
 		return err
 	}
 
-	err = probeScheduler.workerPoolAdapter.Register(SEND_DYNAMIC_PROBE_HANDLER, probeScheduler.sendDynamicProbe)
+	err = probeScheduler.workerPoolAdapter.RegisterContext(SEND_ESCALATION_STEP_HANDLER, probeScheduler.sendEscalationStep,
+		emergencyHandlerOptions)
+	if err != nil {
+		return err
+	}
+
+	err = probeScheduler.workerPoolAdapter.RegisterContext(SEND_ACKNOWLEDGEMENT_NOTICE_HANDLER, probeScheduler.sendAcknowledgementNotice, work.HandlerOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = probeScheduler.workerPoolAdapter.RegisterContext(LIFT_SNOOZE_HANDLER, probeScheduler.liftSnooze, work.HandlerOptions{})
+	if err != nil {
+		return err
+	}
+
+	err = probeScheduler.workerPoolAdapter.RegisterContext(RELEASE_PAYLOAD_HANDLER, probeScheduler.releasePayload, work.HandlerOptions{})
 	if err != nil {
 		return err
 	}
@@ -401,10 +1188,54 @@ func (probeScheduler *ProbeScheduler) registerWorkerHandlers() error {
 	return nil
 }
 
+// isProbeActive returns true if the schedule the probe was sent for is still active
+// i.e. the probe schedule (if any), otherwise the user's probe settings
+func isProbeActive(user *models.User, probe *models.Probe) (bool, error) {
+	if probe.ProbeScheduleID == nil {
+		return user.ProbeSettings.Active, nil
+	}
+
+	schedule, err := user.FindProbeSchedule(*probe.ProbeScheduleID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return schedule.Active, nil
+}
+
 func probeName(userID interface{}) string {
 	return fmt.Sprintf("%v-%v", SEND_LIVELINESS_PROBE_HANDLER, userID)
 }
 
+func scheduledProbeName(probeScheduleID interface{}) string {
+	return fmt.Sprintf("%v-schedule-%v", SEND_LIVELINESS_PROBE_HANDLER, probeScheduleID)
+}
+
+func catchUpProbeName(userID interface{}) string {
+	return fmt.Sprintf("%v-catch-up-%v", SEND_LIVELINESS_PROBE_HANDLER, userID)
+}
+
 func followupProbeName(userID interface{}) string {
 	return fmt.Sprintf("%v-%v", SEND_FOLLOWUP_PROBE_HANDLER, userID)
 }
+
+func escalationStepName(probeID interface{}, position int) string {
+	return fmt.Sprintf("%v-%v-%v", SEND_ESCALATION_STEP_HANDLER, probeID, position)
+}
+
+// AcknowledgementNoticeName returns the string used as tag for an acknowledgement notice job name
+func AcknowledgementNoticeName(emergencyProbeID interface{}) string {
+	return fmt.Sprintf("%v-%v", SEND_ACKNOWLEDGEMENT_NOTICE_HANDLER, emergencyProbeID)
+}
+
+func liftSnoozeName(userID interface{}, endsAt time.Time) string {
+	return fmt.Sprintf("%v-%v-%v", LIFT_SNOOZE_HANDLER, userID, endsAt.Unix())
+}
+
+func releasePayloadName(payloadReleaseID interface{}) string {
+	return fmt.Sprintf("%v-%v", RELEASE_PAYLOAD_HANDLER, payloadReleaseID)
+}
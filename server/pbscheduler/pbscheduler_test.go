@@ -1,14 +1,15 @@
 package pbscheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
+	"github.com/Daskott/kronus/server/messenger"
 	"github.com/Daskott/kronus/server/models"
-	"github.com/Daskott/kronus/server/twilio"
 	"github.com/Daskott/kronus/server/work"
-	"github.com/Daskott/kronus/shared"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,11 +20,9 @@ func TestScheduleProbes(t *testing.T) {
 	workerPool, err := work.NewWorkerAdapter("UTC", true)
 	assert.Nil(t, err)
 
-	pbScheduler, err := NewProbeScheduler(
-		workerPool,
-		twilio.NewClient(shared.TwilioConfig{}, "", true),
-		everySecondCronExp,
-	)
+	msgClient := messenger.NewMemoryMessenger()
+	mailer := messenger.NewMemoryMailer()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, mailer, nil, nil, everySecondCronExp)
 	assert.Nil(t, err)
 
 	testUser := &models.User{
@@ -187,22 +186,805 @@ func TestScheduleProbes(t *testing.T) {
 			assert.Nil(t, err)
 
 			probe := probes[0]
-			if !tcase.expectedToHaveEmergencyProbe && probe.EmergencyProbe != nil {
-				t.Fatalf("Expected user to have emergency probe recorded, found: %v", probe.EmergencyProbe)
+			if !tcase.expectedToHaveEmergencyProbe && len(probe.EmergencyProbes) > 0 {
+				t.Fatalf("Expected user to have emergency probe recorded, found: %v", probe.EmergencyProbes)
 			}
 
 			if tcase.expectedToHaveEmergencyProbe {
-				if probe.EmergencyProbe == nil {
-					t.Fatalf("Expected user to have emergency probe recorded, found none. Probe: %v", probe)
+				if len(probe.EmergencyProbes) != 1 {
+					t.Fatalf("Expected user to have 1 emergency probe recorded, found %v. Probe: %v",
+						len(probe.EmergencyProbes), probe)
 				}
 
-				if probe.EmergencyProbe.ContactID != tcase.expectedEmergencyContact.ID {
+				if probe.EmergencyProbes[0].ContactID != tcase.expectedEmergencyContact.ID {
 					t.Fatalf("Expected emergency probe to be sent to contact with ID=%v, got sent to contact with ID=%v",
-						tcase.expectedEmergencyContact.ID, probe.EmergencyProbe.ContactID)
+						tcase.expectedEmergencyContact.ID, probe.EmergencyProbes[0].ContactID)
 				}
+
+				assert.Len(t, msgClient.MessagesTo(tcase.expectedEmergencyContact.PhoneNumber), 1,
+					"Emergency contact should receive exactly one message")
+				assert.Len(t, mailer.EmailsTo(tcase.expectedEmergencyContact.Email), 1,
+					"Emergency contact should receive exactly one email")
 			}
 		})
 	}
 
 	workerPool.Stop()
 }
+
+func TestSendEmergencyProbeWithEscalationPolicy(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "bruce",
+		LastName:    "banner",
+		Email:       "banner@avengers.com",
+		Password:    "smash",
+		PhoneNumber: "+42345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	firstContact := &models.Contact{
+		FirstName:   "natasha",
+		LastName:    "romanoff",
+		PhoneNumber: "+52345678900",
+		Email:       "widow@avengers.com",
+	}
+	secondContact := &models.Contact{
+		FirstName:   "clint",
+		LastName:    "barton",
+		PhoneNumber: "+62345678900",
+		Email:       "hawkeye@avengers.com",
+	}
+	assert.Nil(t, testUser.AddContact(firstContact))
+	assert.Nil(t, testUser.AddContact(secondContact))
+
+	err = testUser.SetEscalationPolicy([]models.EscalationStep{
+		{ContactID: firstContact.ID, DelayInMinutes: 0},
+		{ContactID: secondContact.ID, DelayInMinutes: 30},
+	})
+	assert.Nil(t, err)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	err = pbScheduler.sendEmergencyProbe(context.Background(), map[string]interface{}{
+		"user_id":      testUser.ID,
+		"probe_id":     probe.ID,
+		"probe_status": models.UNAVAILABLE_PROBE,
+	})
+	assert.Nil(t, err)
+
+	// Only the first contact should be reached out to immediately
+	assert.Len(t, msgClient.MessagesTo(firstContact.PhoneNumber), 1)
+	assert.Len(t, msgClient.MessagesTo(secondContact.PhoneNumber), 0)
+
+	probes, _, err := models.FetchProbes(1, "user_id = ?", testUser.ID)
+	assert.Nil(t, err)
+	assert.Len(t, probes[0].EmergencyProbes, 1)
+	assert.Equal(t, firstContact.ID, probes[0].EmergencyProbes[0].ContactID)
+
+	// The next step should be scheduled
+	jobs, _, err := models.FetchJobsByStatus(models.SCHEDULED_JOB, 1)
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, escalationStepName(probe.ID, 1), jobs[0].Name)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), jobs[0].AddToQueueAt, time.Minute)
+
+	// Run the next step
+	err = pbScheduler.sendEscalationStep(context.Background(), map[string]interface{}{
+		"user_id":      testUser.ID,
+		"probe_id":     probe.ID,
+		"probe_status": models.UNAVAILABLE_PROBE,
+		"position":     1,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(secondContact.PhoneNumber), 1)
+
+	probes, _, err = models.FetchProbes(1, "user_id = ?", testUser.ID)
+	assert.Nil(t, err)
+	assert.Len(t, probes[0].EmergencyProbes, 2)
+	assert.Equal(t, secondContact.ID, probes[0].EmergencyProbes[1].ContactID)
+	assert.Equal(t, 1, probes[0].EmergencyProbes[1].Position)
+
+	// 'emergency_probe' is still the latest emergency probe sent out
+	assert.NotNil(t, probes[0].EmergencyProbe)
+	assert.Equal(t, probes[0].EmergencyProbes[1].ID, probes[0].EmergencyProbe.ID)
+}
+
+func TestProbesDisabledOnceFirstContactIsReached(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "stephen",
+		LastName:    "strange",
+		Email:       "sorcerer@avengers.com",
+		Password:    "dormammu",
+		PhoneNumber: "+42345678911",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	contact := &models.Contact{
+		FirstName:   "wong",
+		LastName:    "sorcerer",
+		PhoneNumber: "+52345678911",
+		Email:       "wong@avengers.com",
+	}
+	assert.Nil(t, testUser.AddContact(contact))
+
+	err = testUser.SetEscalationPolicy([]models.EscalationStep{{ContactID: contact.ID, DelayInMinutes: 15}})
+	assert.Nil(t, err)
+
+	err = testUser.UpdateProbSettings(map[string]interface{}{"active": true})
+	assert.Nil(t, err)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	params := map[string]interface{}{
+		"user_id":      testUser.ID,
+		"probe_id":     probe.ID,
+		"probe_status": models.UNAVAILABLE_PROBE,
+	}
+	assert.Nil(t, pbScheduler.sendEmergencyProbe(context.Background(), params))
+
+	// No contact has been reached out to yet, so the user's probes are left on
+	assert.Len(t, msgClient.MessagesTo(contact.PhoneNumber), 0)
+	probeSettings, err := models.FindProbeSettings(testUser.ID)
+	assert.Nil(t, err)
+	assert.True(t, probeSettings.Active)
+
+	params["position"] = 0
+	assert.Nil(t, pbScheduler.sendEscalationStep(context.Background(), params))
+
+	assert.Len(t, msgClient.MessagesTo(contact.PhoneNumber), 1)
+	probeSettings, err = models.FindProbeSettings(testUser.ID)
+	assert.Nil(t, err)
+	assert.False(t, probeSettings.Active)
+}
+
+func TestAcknowledgedEmergencyProbeStopsEscalation(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "peter",
+		LastName:    "quill",
+		Email:       "starlord@guardians.com",
+		Password:    "awesome-mix",
+		PhoneNumber: "+72345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	firstContact := &models.Contact{
+		FirstName:   "gamora",
+		LastName:    "zen",
+		PhoneNumber: "+82345678900",
+		Email:       "gamora@guardians.com",
+	}
+	secondContact := &models.Contact{
+		FirstName:   "rocket",
+		LastName:    "raccoon",
+		PhoneNumber: "+92345678900",
+		Email:       "rocket@guardians.com",
+	}
+	assert.Nil(t, testUser.AddContact(firstContact))
+	assert.Nil(t, testUser.AddContact(secondContact))
+
+	err = testUser.SetEscalationPolicy([]models.EscalationStep{
+		{ContactID: firstContact.ID, DelayInMinutes: 0},
+		{ContactID: secondContact.ID, DelayInMinutes: 30},
+	})
+	assert.Nil(t, err)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	err = pbScheduler.sendEmergencyProbe(context.Background(), map[string]interface{}{
+		"user_id":      testUser.ID,
+		"probe_id":     probe.ID,
+		"probe_status": models.BAD_PROBE,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(firstContact.PhoneNumber), 1)
+
+	// First contact acknowledges via SMS
+	emergencyProbe, err := models.LastUnacknowledgedEmergencyProbe(firstContact.PhoneNumber, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, probe.ID, emergencyProbe.ProbeID)
+
+	acknowledged, err := emergencyProbe.Acknowledge()
+	assert.Nil(t, err)
+	assert.True(t, acknowledged)
+
+	acknowledged, err = emergencyProbe.Acknowledge()
+	assert.Nil(t, err)
+	assert.False(t, acknowledged, "Emergency probe should only be acknowledged once")
+
+	// The next step should be skipped
+	err = pbScheduler.sendEscalationStep(context.Background(), map[string]interface{}{
+		"user_id":      testUser.ID,
+		"probe_id":     probe.ID,
+		"probe_status": models.BAD_PROBE,
+		"position":     1,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(secondContact.PhoneNumber), 0)
+
+	probes, _, err := models.FetchProbes(1, "user_id = ?", testUser.ID)
+	assert.Nil(t, err)
+	assert.Len(t, probes[0].EmergencyProbes, 1)
+	assert.NotNil(t, probes[0].EmergencyProbes[0].AcknowledgedAt)
+
+	// User should be told who's on it
+	userMessageCount := len(msgClient.MessagesTo(testUser.PhoneNumber))
+	err = pbScheduler.sendAcknowledgementNotice(context.Background(), map[string]interface{}{
+		"user_id":            testUser.ID,
+		"emergency_probe_id": emergencyProbe.ID,
+	})
+	assert.Nil(t, err)
+
+	userMessages := msgClient.MessagesTo(testUser.PhoneNumber)
+	assert.Len(t, userMessages, userMessageCount+1)
+	assert.Contains(t, userMessages[len(userMessages)-1].Body, "Gamora")
+	assert.Len(t, msgClient.MessagesTo(firstContact.PhoneNumber), 1, "Acknowledging contact should not be notified")
+}
+
+func TestSnoozeProbes(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "steve",
+		LastName:    "rogers",
+		Email:       "cap@avengers.com",
+		Password:    "on-your-left",
+		PhoneNumber: "+15345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	err = testUser.UpdateProbSettings(map[string]interface{}{"active": true})
+	assert.Nil(t, err)
+
+	endsAt := time.Now().Add(time.Hour)
+	err = pbScheduler.Snooze(testUser, time.Now(), endsAt)
+	assert.Nil(t, err)
+	assert.True(t, testUser.ProbeSettings.IsSnoozed(time.Now()))
+	assert.False(t, testUser.ProbeSettings.IsSnoozed(endsAt))
+
+	jobs, _, err := models.FetchJobsByStatus(models.SCHEDULED_JOB, 1)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, jobs)
+	assert.Equal(t, liftSnoozeName(testUser.ID, endsAt), jobs[0].Name, "Lift snooze job should be the latest scheduled")
+
+	// Liveliness probe should be skipped while snoozed
+	err = pbScheduler.sendLivelinessProbe(context.Background(), map[string]interface{}{
+		"user_id":    testUser.ID,
+		"first_name": testUser.FirstName,
+		"last_name":  testUser.LastName,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 0)
+
+	// A stale lift snooze job should be skipped
+	err = pbScheduler.liftSnooze(context.Background(), map[string]interface{}{
+		"user_id":        testUser.ID,
+		"snooze_ends_at": endsAt.Add(-time.Minute).Unix(),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 0)
+
+	err = pbScheduler.liftSnooze(context.Background(), map[string]interface{}{
+		"user_id":        testUser.ID,
+		"snooze_ends_at": endsAt.Unix(),
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 1, "User should be told the snooze is over")
+
+	user, err := models.FindUserBy("id", testUser.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, user.ProbeSettings.SnoozeEndsAt)
+}
+
+func TestDeferProbesForQuietHours(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	overnight := models.ProbeSetting{QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	quietHoursTestCases := []struct {
+		at            time.Time
+		inQuietHours  bool
+		expectedStart time.Time
+		expectedEnd   time.Time
+	}{
+		{time.Date(2022, 1, 10, 23, 0, 0, 0, time.UTC), true,
+			time.Date(2022, 1, 10, 22, 0, 0, 0, time.UTC), time.Date(2022, 1, 11, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2022, 1, 11, 6, 0, 0, 0, time.UTC), true,
+			time.Date(2022, 1, 10, 22, 0, 0, 0, time.UTC), time.Date(2022, 1, 11, 7, 0, 0, 0, time.UTC)},
+		{time.Date(2022, 1, 11, 12, 0, 0, 0, time.UTC), false, time.Time{}, time.Time{}},
+	}
+
+	for _, tcase := range quietHoursTestCases {
+		start, end, ok := overnight.QuietHoursAt(tcase.at, time.UTC)
+		assert.Equal(t, tcase.inQuietHours, ok, "Quiet hours at %v", tcase.at)
+		if tcase.inQuietHours {
+			assert.Equal(t, tcase.expectedStart, start)
+			assert.Equal(t, tcase.expectedEnd, end)
+		}
+	}
+
+	testUser := &models.User{
+		FirstName:   "thor",
+		LastName:    "odinson",
+		Email:       "thor@avengers.com",
+		Password:    "mjolnir",
+		PhoneNumber: "+16345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	// Quiet hours around the current time
+	now := time.Now().UTC()
+	err = testUser.UpdateProbSettings(map[string]interface{}{
+		"quiet_hours_start": now.Add(-time.Hour).Format(models.QUIET_HOURS_LAYOUT),
+		"quiet_hours_end":   now.Add(time.Hour).Format(models.QUIET_HOURS_LAYOUT),
+	})
+	assert.Nil(t, err)
+	assert.True(t, testUser.ProbeSettings.EmergencyBypassesQuietHours)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+	assert.Nil(t, probe.Update(map[string]interface{}{"updated_at": now.Add(-2 * time.Hour)}))
+
+	deferred, err := pbScheduler.deferProbeForQuietHours(probe)
+	assert.Nil(t, err)
+	assert.True(t, deferred, "Followup should be deferred during quiet hours")
+
+	// The wait clock is paused for the quiet hours i.e. 2hrs
+	probe, err = models.FindProbe(probe.ID)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, now, probe.UpdatedAt, time.Minute)
+
+	// Emergency probes bypass quiet hours by default
+	assert.Nil(t, probe.Update(map[string]interface{}{"retry_count": probe.MaxRetries}))
+	deferred, err = pbScheduler.deferProbeForQuietHours(probe)
+	assert.Nil(t, err)
+	assert.False(t, deferred, "Emergency probe should bypass quiet hours")
+
+	err = testUser.UpdateProbSettings(map[string]interface{}{"emergency_bypasses_quiet_hours": false})
+	assert.Nil(t, err)
+	deferred, err = pbScheduler.deferProbeForQuietHours(probe)
+	assert.Nil(t, err)
+	assert.True(t, deferred, "Emergency probe should be deferred during quiet hours")
+}
+
+func TestProbeSchedules(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "sam",
+		LastName:    "wilson",
+		Email:       "falcon@avengers.com",
+		Password:    "redwing",
+		PhoneNumber: "+17345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	hikeSchedule := &models.ProbeSchedule{
+		Name:              "sunday hike",
+		Active:            true,
+		CronExpression:    "0 0 18 * * 0",
+		MaxRetries:        1,
+		WaitTimeInMinutes: 15,
+	}
+	assert.Nil(t, testUser.AddProbeSchedule(hikeSchedule))
+
+	err = testUser.AddProbeSchedule(&models.ProbeSchedule{Name: "sunday hike", CronExpression: "0 9 * * 1"})
+	assert.ErrorIs(t, err, models.ErrDuplicateProbeScheduleName)
+
+	err = pbScheduler.PeriodicallyPerformProbeSchedule(*testUser, *hikeSchedule)
+	assert.Nil(t, err)
+
+	err = pbScheduler.sendLivelinessProbe(context.Background(), map[string]interface{}{
+		"user_id":           testUser.ID,
+		"first_name":        testUser.FirstName,
+		"last_name":         testUser.LastName,
+		"probe_schedule_id": hikeSchedule.ID,
+	})
+	assert.Nil(t, err)
+
+	messages := msgClient.MessagesTo(testUser.PhoneNumber)
+	assert.Len(t, messages, 1, "Probe should be sent for an active schedule, even if probe settings are disabled")
+	assert.Contains(t, messages[0].Body, hikeSchedule.Name)
+
+	probe, err := testUser.LastProbe()
+	assert.Nil(t, err)
+	assert.Equal(t, hikeSchedule.ID, *probe.ProbeScheduleID)
+	assert.Equal(t, hikeSchedule.MaxRetries, probe.MaxRetries)
+	assert.Equal(t, hikeSchedule.WaitTimeInMinutes, probe.WaitTimeInMinutes)
+
+	// Disabling all probes should disable the schedule too
+	err = pbScheduler.DisableAllPeriodicProbes(testUser)
+	assert.Nil(t, err)
+
+	hikeSchedule, err = testUser.FindProbeSchedule(hikeSchedule.ID)
+	assert.Nil(t, err)
+	assert.False(t, hikeSchedule.Active)
+
+	err = pbScheduler.sendLivelinessProbe(context.Background(), map[string]interface{}{
+		"user_id":           testUser.ID,
+		"first_name":        testUser.FirstName,
+		"last_name":         testUser.LastName,
+		"probe_schedule_id": hikeSchedule.ID,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 1, "Probe should be skipped for a disabled schedule")
+
+	// Probes sent for a deleted schedule are kept
+	assert.Nil(t, testUser.DeleteProbeSchedule(hikeSchedule.ID))
+	probe, err = models.FindProbe(probe.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, probe.ProbeScheduleID)
+}
+
+func TestJitterLivelinessProbe(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "scott",
+		LastName:    "lang",
+		Email:       "antman@avengers.com",
+		Password:    "quantum",
+		PhoneNumber: "+18345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	err = testUser.UpdateProbSettings(map[string]interface{}{"active": true, "jitter_window_in_minutes": 120})
+	assert.Nil(t, err)
+
+	params := map[string]interface{}{
+		"user_id":    testUser.ID,
+		"first_name": testUser.FirstName,
+		"last_name":  testUser.LastName,
+	}
+
+	// The cron trigger should schedule the probe within the jitter window, instead of sending it
+	err = pbScheduler.sendLivelinessProbe(context.Background(), params)
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 0)
+
+	jobs, _, err := models.FetchJobsByStatus(models.SCHEDULED_JOB, 1)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, jobs)
+
+	job := jobs[0]
+	assert.Equal(t, SEND_LIVELINESS_PROBE_HANDLER, job.Handler)
+	assert.True(t, job.AddToQueueAt.After(time.Now().Add(-time.Minute)))
+	assert.True(t, job.AddToQueueAt.Before(time.Now().Add(120*time.Minute)))
+	assert.Contains(t, job.Args, fmt.Sprintf(`"send_at":%v`, job.AddToQueueAt.Unix()),
+		"Chosen send time should be persisted with the job")
+
+	// Once the chosen time is up, the probe is sent
+	params["send_at"] = job.AddToQueueAt.Unix()
+	err = pbScheduler.sendLivelinessProbe(context.Background(), params)
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(testUser.PhoneNumber), 1)
+}
+
+// plaintextDecrypter returns the ciphertext as is, so tests can store release payloads unencrypted
+type plaintextDecrypter struct{}
+
+func (plaintextDecrypter) Decrypt(ciphertext []byte) ([]byte, error) {
+	return ciphertext, nil
+}
+
+func TestReleasePayloads(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	mailer := messenger.NewMemoryMailer()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, mailer, nil, plaintextDecrypter{}, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "natasha",
+		LastName:    "romanoff",
+		Email:       "widow@avengers.com",
+		Password:    "red-room",
+		PhoneNumber: "+19345678900",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	contact := &models.Contact{
+		FirstName:          "clint",
+		LastName:           "barton",
+		PhoneNumber:        "+19445678900",
+		Email:              "hawkeye@avengers.com",
+		IsEmergencyContact: true,
+	}
+	assert.Nil(t, testUser.AddContact(contact))
+
+	err = testUser.AddReleasePayload(&models.ReleasePayload{
+		Name:      "budapest",
+		ContactID: contact.ID,
+		Message:   []byte("The safe house is in Budapest"),
+		Attachments: []models.ReleasePayloadAttachment{
+			{FileName: "map.txt", ContentType: "text/plain", Size: 7, Content: []byte("go west")},
+		},
+	})
+	assert.Nil(t, err)
+
+	err = testUser.AddReleasePayload(&models.ReleasePayload{
+		Name:           "ledger",
+		ContactID:      contact.ID,
+		Message:        []byte("My ledger is in the red"),
+		DelayInMinutes: 60,
+	})
+	assert.Nil(t, err)
+
+	err = testUser.AddReleasePayload(&models.ReleasePayload{Name: "budapest", ContactID: contact.ID, Message: []byte("?")})
+	assert.Equal(t, models.ErrDuplicateReleasePayloadName, err)
+
+	err = testUser.AddReleasePayload(&models.ReleasePayload{Name: "stranger", ContactID: 0, Message: []byte("?")})
+	assert.Equal(t, models.ErrUnknownReleasePayloadContact, err)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+
+	err = pbScheduler.sendEmergencyProbe(context.Background(), map[string]interface{}{
+		"user_id":      testUser.ID,
+		"probe_id":     probe.ID,
+		"probe_status": models.UNAVAILABLE_PROBE,
+	})
+	assert.Nil(t, err)
+
+	// Retrying shouldn't schedule the payloads again
+	err = pbScheduler.schedulePayloadReleases(testUser, probe.ID)
+	assert.Nil(t, err)
+
+	payloadReleases, err := testUser.FetchPendingPayloadReleases()
+	assert.Nil(t, err)
+	assert.Len(t, payloadReleases, 2)
+	assert.Equal(t, "budapest", payloadReleases[0].ReleasePayload.Name)
+
+	err = pbScheduler.releasePayload(context.Background(), map[string]interface{}{
+		"user_id":            testUser.ID,
+		"payload_release_id": payloadReleases[0].ID,
+	})
+	assert.Nil(t, err)
+
+	contactMessages := msgClient.MessagesTo(contact.PhoneNumber)
+	assert.Contains(t, contactMessages[len(contactMessages)-1].Body, "The safe house is in Budapest")
+
+	assert.Contains(t, contactMessages[len(contactMessages)-1].Body, "also left you 1 attachment(s)")
+
+	contactEmails := mailer.EmailsTo(contact.Email)
+	assert.Equal(t, "A message from Natasha, sent by kronus", contactEmails[len(contactEmails)-1].Subject)
+	assert.Equal(t, []messenger.Attachment{{FileName: "map.txt", ContentType: "text/plain", Content: []byte("go west")}},
+		contactEmails[len(contactEmails)-1].Attachments)
+
+	// The user checks in before the second payload is released
+	cancelled, err := testUser.CancelPendingPayloadReleases()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cancelled)
+
+	contactMessageCount := len(msgClient.MessagesTo(contact.PhoneNumber))
+	err = pbScheduler.releasePayload(context.Background(), map[string]interface{}{
+		"user_id":            testUser.ID,
+		"payload_release_id": payloadReleases[1].ID,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, msgClient.MessagesTo(contact.PhoneNumber), contactMessageCount,
+		"Cancelled payload should not be released")
+
+	// A deleted payload is skipped, instead of being retried
+	assert.Nil(t, testUser.DeleteReleasePayload(payloadReleases[1].ReleasePayloadID))
+	err = pbScheduler.releasePayload(context.Background(), map[string]interface{}{
+		"user_id":            testUser.ID,
+		"payload_release_id": payloadReleases[1].ID,
+	})
+	assert.Nil(t, err)
+}
+
+// failingMailer fails to send every email
+type failingMailer struct{}
+
+func (failingMailer) SendEmail(ctx context.Context, email messenger.Email) error {
+	return errors.New("smtp server is down")
+}
+
+func TestReleasePayloadAttachmentsNotEmailed(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, failingMailer{}, nil, plaintextDecrypter{}, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "wanda",
+		LastName:    "maximoff",
+		Email:       "scarlet-witch@avengers.com",
+		Password:    "westview",
+		PhoneNumber: "+19345678901",
+	}
+	assert.Nil(t, models.CreateUser(testUser))
+
+	contact := &models.Contact{
+		FirstName:          "vision",
+		LastName:           "mind-stone",
+		PhoneNumber:        "+19445678901",
+		Email:              "vision@avengers.com",
+		IsEmergencyContact: true,
+	}
+	assert.Nil(t, testUser.AddContact(contact))
+
+	err = testUser.AddReleasePayload(&models.ReleasePayload{
+		Name:      "hex",
+		ContactID: contact.ID,
+		Message:   []byte("The hex is around Westview"),
+		Attachments: []models.ReleasePayloadAttachment{
+			{FileName: "map.txt", ContentType: "text/plain", Size: 8, Content: []byte("go north")},
+		},
+	})
+	assert.Nil(t, err)
+
+	probe, err := models.CreateProbe(testUser.ID, 60, 3)
+	assert.Nil(t, err)
+	assert.Nil(t, pbScheduler.schedulePayloadReleases(testUser, probe.ID))
+
+	payloadReleases, err := testUser.FetchPendingPayloadReleases()
+	assert.Nil(t, err)
+	assert.Len(t, payloadReleases, 1)
+
+	params := map[string]interface{}{"user_id": testUser.ID, "payload_release_id": payloadReleases[0].ID}
+
+	// The release is retried, as the attachments couldn't be emailed
+	assert.NotNil(t, pbScheduler.releasePayload(context.Background(), params))
+	assert.Len(t, msgClient.MessagesTo(contact.PhoneNumber), 0)
+
+	payloadReleases, err = testUser.FetchPendingPayloadReleases()
+	assert.Nil(t, err)
+	assert.Len(t, payloadReleases, 1, "Payload should still be pending")
+
+	// Without a mailer, the message is still released, but the attachments aren't mentioned
+	withoutMailer := *pbScheduler
+	withoutMailer.mailer = nil
+	assert.Nil(t, withoutMailer.releasePayload(context.Background(), params))
+
+	contactMessages := msgClient.MessagesTo(contact.PhoneNumber)
+	assert.Len(t, contactMessages, 1)
+	assert.Contains(t, contactMessages[0].Body, "The hex is around Westview")
+	assert.NotContains(t, contactMessages[0].Body, "attachment")
+}
+
+func TestCatchUpMissedProbes(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	msgClient := messenger.NewMemoryMessenger()
+	pbScheduler, err := NewProbeScheduler(workerPool, msgClient, nil, nil, nil, "*/1 * * * * *")
+	assert.Nil(t, err)
+
+	testUser := &models.User{
+		FirstName:   "carol",
+		LastName:    "danvers",
+		Email:       "marvel@avengers.com",
+		Password:    "binary",
+		PhoneNumber: "+19345678955",
+	}
+	err = models.CreateUser(testUser)
+	assert.Nil(t, err, "Should create 'testUser' record")
+
+	hourlyCronExp := "0 0 * * * *"
+	err = testUser.UpdateProbSettings(map[string]interface{}{"active": true, "cron_expression": hourlyCronExp})
+	assert.Nil(t, err)
+
+	schedule := &models.ProbeSchedule{Name: "half past", Active: true, CronExpression: "0 30 * * * *"}
+	assert.Nil(t, testUser.AddProbeSchedule(schedule))
+
+	testUser, err = models.FindUserBy("id", testUser.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, pbScheduler.PeriodicallyPerfomProbe(*testUser))
+	assert.Nil(t, pbScheduler.PeriodicallyPerformProbeSchedule(*testUser, *schedule))
+
+	// Simulate the server being down for the last 5 hours
+	lastRunAt := time.Now().Add(-5 * time.Hour)
+	for _, name := range []string{probeName(testUser.ID), scheduledProbeName(schedule.ID)} {
+		periodicJob, err := models.FindPeriodicJobByName(name)
+		assert.Nil(t, err)
+		assert.Nil(t, periodicJob.Update(map[string]interface{}{"last_run_at": lastRunAt}))
+	}
+
+	missedRuns, err := workerPool.MissedRuns(SEND_LIVELINESS_PROBE_HANDLER, 3*time.Hour)
+	assert.Nil(t, err)
+
+	missed := 0
+	for _, missedRun := range missedRuns {
+		if fmt.Sprint(missedRun.Job.Args["user_id"]) == fmt.Sprint(testUser.ID) {
+			missed += missedRun.Missed
+		}
+	}
+	assert.Equal(t, 6, missed, "Only probes missed within the window should count")
+
+	err = pbScheduler.CatchUpMissedProbes(3 * time.Hour)
+	assert.Nil(t, err)
+
+	catchUpJobs := 0
+	jobs, _, err := models.FetchJobsByStatus(models.ENQUEUED_JOB, 1)
+	assert.Nil(t, err)
+	for _, job := range jobs {
+		if job.Name == catchUpProbeName(testUser.ID) {
+			catchUpJobs++
+			assert.Contains(t, job.Args, "send_at", "Catch-up probe should be sent right away")
+		}
+	}
+	assert.Equal(t, 1, catchUpJobs, "Expected a single catch-up probe for the user")
+
+	// Probes that have been caught up, aren't caught up again
+	missedRuns, err = workerPool.MissedRuns(SEND_LIVELINESS_PROBE_HANDLER, 3*time.Hour)
+	assert.Nil(t, err)
+	for _, missedRun := range missedRuns {
+		assert.NotEqual(t, fmt.Sprint(testUser.ID), fmt.Sprint(missedRun.Job.Args["user_id"]))
+	}
+}
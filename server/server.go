@@ -6,14 +6,17 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/Daskott/kronus/server/auth"
 	"github.com/Daskott/kronus/server/auth/key"
 	"github.com/Daskott/kronus/server/gstorage"
 	"github.com/Daskott/kronus/server/logger"
+	"github.com/Daskott/kronus/server/messenger"
 	"github.com/Daskott/kronus/server/models"
 	"github.com/Daskott/kronus/server/pbscheduler"
 	"github.com/Daskott/kronus/server/twilio"
+	"github.com/Daskott/kronus/server/webhook"
 	"github.com/Daskott/kronus/server/work"
 	"github.com/Daskott/kronus/shared"
 	"github.com/go-playground/validator"
@@ -26,13 +29,50 @@ var (
 	authKeyPair    *key.KeyPair
 	storage        *gstorage.GStorage
 	twilioClient   *twilio.ClientWrapper
+	messageClient  messenger.Messenger
+	mailer         messenger.Mailer
 	config         *shared.ServerConfig
 	configDir      string
 
+	// Closed when the server starts shutting down, so long-lived requests e.g. event streams can end
+	shuttingDown = make(chan struct{})
+
 	validate = validator.New()
 	logg     = logger.NewLogger()
 )
 
+const (
+	// How long a probe check-in link is valid for
+	CHECK_IN_LINK_TTL = 24 * time.Hour
+
+	// How long an emergency probe acknowledgement link is valid for
+	ACKNOWLEDGEMENT_LINK_TTL = 7 * 24 * time.Hour
+
+	// The longest a user can snooze their liveliness probes for
+	MAX_SNOOZE_DURATION = 90 * 24 * time.Hour
+
+	// Layout of times in the sms snooze cmd
+	SNOOZE_CMD_TIME_LAYOUT = "2006-01-02T15:04"
+
+	// Saved as a probe's 'LastResponse' when the user responds with a pin
+	PIN_RESPONSE = "[pin]"
+
+	// No. of events buffered for each event stream client, before events are dropped for it
+	EVENT_STREAM_BUFFER_SIZE = 64
+
+	// How often a comment is sent on an idle event stream, so proxies don't close the connection
+	EVENT_STREAM_KEEP_ALIVE = 30 * time.Second
+
+	CHECK_IN_PAGE_TITLE        = "Kronus check in"
+	ACKNOWLEDGEMENT_PAGE_TITLE = "Kronus emergency alert"
+)
+
+// The 'last_response' recorded for a probe, when the user responds via a check-in link or the rest API
+var CheckInLinkResponses = map[string]string{
+	models.GOOD_PROBE: "I'm OK",
+	models.BAD_PROBE:  "I need help",
+}
+
 type RequestContextKey string
 
 type DecodedJWT struct {
@@ -65,18 +105,39 @@ func Start(configArg *shared.ServerConfig, devMode bool) {
 	authKeyPair, err = key.NewKeyPairFromRSAPrivateKeyPem(config.Kronus.PrivateKeyPem)
 	fatalOnError(err)
 
-	workerPool, err = work.NewWorkerAdapter(config.Kronus.Cron.TimeZone, false)
+	workerPool, err = work.NewWorkerAdapterWithQueues(config.Kronus.Cron.TimeZone, false, workerQueues(config.Kronus.Workers))
 	fatalOnError(err)
 
 	registerJobHandlers(workerPool)
-	enqueueJobs(workerPool)
+	err = enqueueJobs(workerPool)
+	fatalOnError(err)
+
+	// The twilio client is always needed to validate requests to the sms webhook
+	twilioClient = twilio.NewClient(config.Twilio, config.Kronus.PublicUrl)
+
+	// In dev mode, messages are always printed to stdout
+	messengerDriver := config.Messenger.Driver
+	if devMode {
+		messengerDriver = messenger.STDOUT_DRIVER
+	}
 
-	twilioClient = twilio.NewClient(config.Twilio, config.Kronus.PublicUrl, devMode)
+	messageClient, err = messenger.New(messengerDriver, *config)
+	fatalOnError(err)
+
+	if enabled, ok := config.Smtp.EnableEmail.(bool); ok && enabled {
+		mailer = messenger.NewSmtpMailer(config.Smtp)
+	}
 
-	probeScheduler, err = pbscheduler.NewProbeScheduler(workerPool, twilioClient, "*/1 * * * *")
+	probeScheduler, err = pbscheduler.NewProbeScheduler(workerPool, messageClient, mailer, signedLinker{}, payloadCipher{}, "*/1 * * * *")
 	fatalOnError(err)
 	probeScheduler.ScheduleProbes()
 
+	err = probeScheduler.CatchUpMissedProbes(time.Duration(config.Kronus.Cron.CatchUpWindowInHours) * time.Hour)
+	fatalOnError(err)
+
+	_, err = webhook.NewDispatcher(workerPool)
+	fatalOnError(err)
+
 	router := mux.NewRouter()
 
 	v1Router := router.PathPrefix("/v1").Subrouter()
@@ -87,6 +148,7 @@ func Start(configArg *shared.ServerConfig, devMode bool) {
 		Addr:    fmt.Sprintf(":%v", config.Kronus.Listener.Port),
 		Handler: router,
 	}
+	server.RegisterOnShutdown(func() { close(shuttingDown) })
 
 	protectedRouter.HandleFunc("/users/{uid:[0-9]+}", findUserHandler).Methods("GET")
 	protectedRouter.HandleFunc("/users/{uid:[0-9]+}", updateUserHandler).Methods("PUT")
@@ -94,7 +156,39 @@ func Start(configArg *shared.ServerConfig, devMode bool) {
 
 	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_settings", updateProbeSettingsHandler).Methods("PUT")
 
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_schedules", fetchProbeSchedulesHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_schedules", createProbeScheduleHandler).Methods("POST")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_schedules/{id:[0-9]+}", updateProbeScheduleHandler).Methods("PUT")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_schedules/{id:[0-9]+}", deleteProbeScheduleHandler).Methods("DELETE")
+
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/snooze", snoozeHandler).Methods("PUT")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/snooze", liftSnoozeHandler).Methods("DELETE")
+
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_pins", fetchProbePinsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probe_pins", updateProbePinsHandler).Methods("PUT")
+
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/release_payloads", fetchReleasePayloadsHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/release_payloads", createReleasePayloadHandler).Methods("POST")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/release_payloads/{id:[0-9]+}", deleteReleasePayloadHandler).Methods("DELETE")
+
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/payload_releases", fetchPayloadReleasesHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/payload_releases", cancelPayloadReleasesHandler).Methods("DELETE")
+
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/webhooks", fetchWebhooksHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/webhooks", createWebhookHandler).Methods("POST")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/webhooks/{id:[0-9]+}", updateWebhookHandler).Methods("PUT")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/webhooks/{id:[0-9]+}", deleteWebhookHandler).Methods("DELETE")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/webhooks/{id:[0-9]+}/deliveries", fetchWebhookDeliveriesHandler).Methods("GET")
+
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/escalation_policy", fetchEscalationPolicyHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/escalation_policy", updateEscalationPolicyHandler).Methods("PUT")
+
 	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probes", fetchUserProbesHandler).Methods("GET")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probes", createProbeHandler).Methods("POST")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probes/{id:[0-9]+}/cancel", cancelProbeHandler).Methods("POST")
+	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/probes/{id:[0-9]+}/respond", respondToProbeHandler).Methods("POST")
+
+	protectedRouter.HandleFunc("/events", eventStreamHandler).Methods("GET")
 
 	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/contacts", fetchUserContactsHandler).Methods("GET")
 	protectedRouter.HandleFunc("/users/{uid:[0-9]+}/contacts", createContactHandler).Methods("POST")
@@ -107,12 +201,32 @@ func Start(configArg *shared.ServerConfig, devMode bool) {
 
 	adminRouter.HandleFunc("/jobs", fetchJobsHandler).Methods("GET")
 	adminRouter.HandleFunc("/jobs/stats", jobsStatsHandler).Methods("GET")
+	adminRouter.HandleFunc("/jobs/retry", retryDeadJobsHandler).Methods("POST")
+	adminRouter.HandleFunc("/jobs/{id:[0-9]+}", findJobHandler).Methods("GET")
+	adminRouter.HandleFunc("/jobs/{id:[0-9]+}", deleteJobHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/jobs/{id:[0-9]+}/attempts", fetchJobAttemptsHandler).Methods("GET")
+	adminRouter.HandleFunc("/jobs/{id:[0-9]+}/retry", retryJobHandler).Methods("POST")
+	adminRouter.HandleFunc("/jobs/{id:[0-9]+}/cancel", cancelJobHandler).Methods("POST")
+	adminRouter.HandleFunc("/periodic_jobs", fetchPeriodicJobsHandler).Methods("GET")
+	adminRouter.HandleFunc("/periodic_jobs/{id:[0-9]+}/pause", pausePeriodicJobHandler).Methods("POST")
+	adminRouter.HandleFunc("/periodic_jobs/{id:[0-9]+}/resume", resumePeriodicJobHandler).Methods("POST")
+	adminRouter.HandleFunc("/periodic_jobs/{id:[0-9]+}/trigger", triggerPeriodicJobHandler).Methods("POST")
 	adminRouter.HandleFunc("/probes/stats", probeStatsHandler).Methods("GET")
 	adminRouter.HandleFunc("/probes", fetchProbesHandler).Methods("GET")
+	adminRouter.HandleFunc("/webhooks", fetchWebhooksHandler).Methods("GET")
+	adminRouter.HandleFunc("/webhooks", createWebhookHandler).Methods("POST")
+	adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", updateWebhookHandler).Methods("PUT")
+	adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", deleteWebhookHandler).Methods("DELETE")
+	adminRouter.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", fetchWebhookDeliveriesHandler).Methods("GET")
 	adminRouter.Use(adminRouteMiddleware)
 
 	router.HandleFunc("/webhook/sms", smsWebhookHandler).Methods("POST")
 
+	router.HandleFunc("/c/{token}", checkInPageHandler).Methods("GET")
+	router.HandleFunc("/c/{token}", checkInHandler).Methods("POST")
+	router.HandleFunc("/a/{token}", acknowledgementPageHandler).Methods("GET")
+	router.HandleFunc("/a/{token}", acknowledgementHandler).Methods("POST")
+
 	router.HandleFunc("/jwks", jwksHandler).Methods("GET")
 	router.HandleFunc("/health", healthCheckHandler).Methods("GET")
 	router.HandleFunc("/login", logInHandler).Methods("POST")
@@ -1,9 +1,12 @@
 package twilio
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Daskott/kronus/colors"
 	"github.com/Daskott/kronus/server/logger"
@@ -15,42 +18,34 @@ import (
 
 var logg = logger.NewLogger()
 
+// How long a request to twilio can take, the same as the twilio client's default
+const REQUEST_TIMEOUT = 10 * time.Second
+
 type ClientWrapper struct {
-	client           *twilio.RestClient
 	config           shared.TwilioConfig
 	requestValidator twilioUtil.RequestValidator
 	webhookBaseURL   string
-	devMode          bool
 }
 
-func NewClient(config shared.TwilioConfig, appUrl string, devMode bool) *ClientWrapper {
-	client := twilio.NewRestClientWithParams(twilio.RestClientParams{
-		Username: config.AccountSid,
-		Password: config.AuthToken,
-	})
-
+func NewClient(config shared.TwilioConfig, appUrl string) *ClientWrapper {
 	return &ClientWrapper{
-		client:           client,
 		config:           config,
-		devMode:          devMode,
 		webhookBaseURL:   appUrl,
 		requestValidator: twilioUtil.NewRequestValidator(config.AuthToken),
 	}
 }
 
-func (cw *ClientWrapper) SendMessage(to, msg string) error {
+// SendMessage sends 'msg' to 'to' by sms. The request to twilio is cancelled once 'ctx' is done.
+func (cw *ClientWrapper) SendMessage(ctx context.Context, to, msg string) error {
 	params := &openapi.CreateMessageParams{}
 	params.SetMessagingServiceSid(cw.config.MessagingServiceSid)
 	params.SetTo(to)
 	params.SetBody(msg)
 
-	// Only log messages to stdout in devMode
-	if cw.devMode {
-		logg.Infof(fmt.Sprintf("%v to: %v; body: %v", colors.Green("[message]"), to, msg))
-		return nil
-	}
+	ctx, cancel := context.WithTimeout(ctx, REQUEST_TIMEOUT)
+	defer cancel()
 
-	resp, err := cw.client.ApiV2010.CreateMessage(params)
+	resp, err := cw.restClient(ctx).ApiV2010.CreateMessage(params)
 	if err != nil {
 		return err
 	}
@@ -64,6 +59,34 @@ func (cw *ClientWrapper) SendMessage(to, msg string) error {
 	return nil
 }
 
+// restClient returns a twilio client whose requests are made with 'ctx',
+// as the twilio client doesn't take a context itself
+func (cw *ClientWrapper) restClient(ctx context.Context) *twilio.RestClient {
+	client := &twilioUtil.Client{
+		Credentials: twilioUtil.NewCredentials(cw.config.AccountSid, cw.config.AuthToken),
+		HTTPClient: &http.Client{
+			Transport: contextTransport{ctx: ctx},
+
+			// Like the twilio client, don't follow redirects
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	client.SetAccountSid(cw.config.AccountSid)
+
+	return twilio.NewRestClientWithParams(twilio.RestClientParams{Client: client})
+}
+
+// contextTransport makes every request with 'ctx'
+type contextTransport struct {
+	ctx context.Context
+}
+
+func (transport contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return http.DefaultTransport.RoundTrip(req.WithContext(transport.ctx))
+}
+
 func (cw *ClientWrapper) ValidateRequest(path string, urlValues url.Values, expectedSignature string) bool {
 	// Get 'urlValues' as map[string]string so it's compatible with twilio request validator
 	params := make(map[string]string)
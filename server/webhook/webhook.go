@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Daskott/kronus/server/events"
+	"github.com/Daskott/kronus/server/logger"
+	"github.com/Daskott/kronus/server/models"
+	"github.com/Daskott/kronus/server/work"
+	"gorm.io/gorm"
+)
+
+const DELIVER_WEBHOOK_HANDLER = "deliver_webhook"
+
+// Headers sent with each delivery
+const (
+	EVENT_HEADER     = "X-Kronus-Event"
+	DELIVERY_HEADER  = "X-Kronus-Delivery"
+	TIMESTAMP_HEADER = "X-Kronus-Timestamp"
+	SIGNATURE_HEADER = "X-Kronus-Signature"
+)
+
+const DELIVERY_TIMEOUT = 10 * time.Second
+
+// The no. of published events waiting to be dispatched, before any more are dropped
+const DISPATCH_BUFFER_SIZE = 1000
+
+// Deliveries have their own queue, so slow webhook endpoints can't hold up probes, alerts or maintenance jobs
+var deliveryHandlerOptions = work.HandlerOptions{
+	// Leaves time to record the delivery, after the request times out
+	Timeout: 2 * DELIVERY_TIMEOUT,
+}
+
+var logg = logger.NewLogger()
+
+var (
+	ErrInvalidUrl          = errors.New("webhook 'url' must be a valid http(s) url")
+	ErrUnresolvableUrl     = errors.New("webhook 'url' host couldn't be resolved")
+	ErrForbiddenUrlAddress = errors.New("webhook 'url' must not resolve to a private, loopback or link-local address")
+)
+
+// allowedIP returns true if webhooks can be delivered to 'ip'. It's only swapped out in tests,
+// so deliveries can be made to local test servers.
+var allowedIP = isPublicIP
+
+// Dispatcher delivers published events to the webhooks subscribed to them,
+// with a job for each delivery so failed deliveries are retried
+type Dispatcher struct {
+	workerPoolAdapter *work.WorkerPoolAdapter
+	client            *http.Client
+
+	// Published events waiting to be dispatched
+	pending chan events.Event
+}
+
+// NewDispatcher creates a new dispatcher & subscribes it to all published events.
+// Events are dispatched in the background, so publishers aren't held up by db queries for each event.
+func NewDispatcher(workerPoolAdapter *work.WorkerPoolAdapter) (*Dispatcher, error) {
+	dispatcher := Dispatcher{
+		workerPoolAdapter: workerPoolAdapter,
+		client:            newClient(),
+		pending:           make(chan events.Event, DISPATCH_BUFFER_SIZE),
+	}
+
+	err := workerPoolAdapter.RegisterContext(DELIVER_WEBHOOK_HANDLER, dispatcher.deliver, deliveryHandlerOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	events.Subscribe(dispatcher.enqueue)
+	go dispatcher.run()
+
+	return &dispatcher, nil
+}
+
+// NewSecret returns a random secret for signing a webhook's deliveries
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature sent in the 'X-Kronus-Signature' header i.e. the hex encoded
+// HMAC-SHA256 of "<timestamp>.<payload>", using the webhook's 'secret' as key
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateUrl returns an error if 'rawUrl' isn't an http(s) url, or its host resolves
+// to an address webhooks can't be delivered to e.g. a private, loopback or link-local address
+func ValidateUrl(rawUrl string) error {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Hostname() == "" {
+		return ErrInvalidUrl
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DELIVERY_TIMEOUT)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsedUrl.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return ErrUnresolvableUrl
+	}
+
+	for _, addr := range addrs {
+		if !allowedIP(addr.IP) {
+			return ErrForbiddenUrlAddress
+		}
+	}
+
+	return nil
+}
+
+// newClient returns the http client deliveries are made with. Every address it connects to is
+// checked as it's dialed, so redirects & hosts which resolve differently after the webhook was
+// created can't reach a private, loopback or link-local address.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: DELIVERY_TIMEOUT,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !allowedIP(ip) {
+				return ErrForbiddenUrlAddress
+			}
+			return nil
+		},
+	}
+
+	// No proxy, since the dialer would only get to check the proxy's address
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: DELIVERY_TIMEOUT,
+	}
+
+	return &http.Client{Transport: transport, Timeout: DELIVERY_TIMEOUT}
+}
+
+// isPublicIP returns false if 'ip' is a private, loopback, link-local, multicast or unspecified address
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// enqueue adds 'event' to the events waiting to be dispatched, without blocking its publisher
+func (dispatcher Dispatcher) enqueue(event events.Event) {
+	// Webhooks can only subscribe to probe lifecycle events
+	if !events.IsValidType(event.Type) {
+		return
+	}
+
+	select {
+	case dispatcher.pending <- event:
+	default:
+		logg.Errorf("dropped '%v' event for userID=%v, too many events are waiting to be dispatched",
+			event.Type, event.UserID)
+	}
+}
+
+// run dispatches the pending events as they're published
+func (dispatcher Dispatcher) run() {
+	for event := range dispatcher.pending {
+		dispatcher.dispatch(event)
+	}
+}
+
+// dispatch enqueues a delivery for each active webhook subscribed to 'event'
+func (dispatcher Dispatcher) dispatch(event events.Event) {
+	webhooks, err := models.ActiveWebhooksForEvent(event.Type, event.UserID)
+	if err != nil {
+		logg.Error(err)
+		return
+	}
+
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logg.Error(err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		deliveryID, err := newDeliveryID()
+		if err != nil {
+			logg.Error(err)
+			return
+		}
+
+		err = dispatcher.workerPoolAdapter.Perform(work.JobParams{
+			Name:    deliveryName(deliveryID),
+			Handler: DELIVER_WEBHOOK_HANDLER,
+			Queue:   work.WEBHOOKS_QUEUE,
+			Args: map[string]interface{}{
+				"webhook_id":  webhook.ID,
+				"delivery_id": deliveryID,
+				"event":       event.Type,
+				"payload":     string(payload),
+			},
+		})
+		if err != nil {
+			logg.Error(err)
+		}
+	}
+}
+
+// deliver POSTs the event's payload to the webhook & records the attempt in the delivery log.
+// Any non 2xx response fails the job, so it's retried. The request is cancelled once 'ctx' is done.
+func (dispatcher Dispatcher) deliver(ctx context.Context, params map[string]interface{}) error {
+	webhook, err := models.FindWebhookByID(params["webhook_id"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		logg.Infof("skipping webhook delivery %v, webhookID=%v was deleted", params["delivery_id"], params["webhook_id"])
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !webhook.Active {
+		logg.Infof("skipping webhook delivery %v, webhookID=%v is inactive", params["delivery_id"], webhook.ID)
+		return nil
+	}
+
+	deliveryID := fmt.Sprint(params["delivery_id"])
+	eventType := fmt.Sprint(params["event"])
+	payload := fmt.Sprint(params["payload"])
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kronus-webhook")
+	req.Header.Set(EVENT_HEADER, eventType)
+	req.Header.Set(DELIVERY_HEADER, deliveryID)
+	req.Header.Set(TIMESTAMP_HEADER, timestamp)
+	req.Header.Set(SIGNATURE_HEADER, Sign(webhook.Secret, timestamp, []byte(payload)))
+
+	delivery := models.WebhookDelivery{
+		WebhookID:  webhook.ID,
+		DeliveryID: deliveryID,
+		Event:      eventType,
+		Payload:    payload,
+	}
+
+	startedAt := time.Now()
+	res, err := dispatcher.client.Do(req)
+	delivery.DurationInMs = time.Since(startedAt).Milliseconds()
+
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		res.Body.Close()
+		delivery.StatusCode = res.StatusCode
+		delivery.Successful = res.StatusCode >= 200 && res.StatusCode < 300
+		if !delivery.Successful {
+			delivery.Error = fmt.Sprintf("unexpected response status: %v", res.Status)
+		}
+	}
+
+	// Don't fail the job if only the log can't be saved
+	if err := models.CreateWebhookDelivery(&delivery); err != nil {
+		logg.Error(err)
+	}
+
+	if !delivery.Successful {
+		return fmt.Errorf("webhook delivery %v to webhookID=%v failed: %v", deliveryID, webhook.ID, delivery.Error)
+	}
+
+	return nil
+}
+
+func newDeliveryID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func deliveryName(deliveryID string) string {
+	return fmt.Sprintf("%v-%v", DELIVER_WEBHOOK_HANDLER, deliveryID)
+}
@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Daskott/kronus/server/events"
+	"github.com/Daskott/kronus/server/models"
+	"github.com/Daskott/kronus/server/work"
+	"github.com/stretchr/testify/assert"
+)
+
+// allowIPs lets deliveries be made to the addresses 'allowed' returns true for e.g. local test servers
+func allowIPs(t *testing.T, allowed func(ip net.IP) bool) {
+	allowedIP = allowed
+	t.Cleanup(func() { allowedIP = isPublicIP })
+}
+
+func TestDeliver(t *testing.T) {
+	models.InitializeTestDb()
+	allowIPs(t, func(net.IP) bool { return true })
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	dispatcher, err := NewDispatcher(workerPool)
+	assert.Nil(t, err)
+
+	responseStatus := http.StatusOK
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		receivedBody <- body
+		rw.WriteHeader(responseStatus)
+	}))
+	defer server.Close()
+
+	webhook := &models.Webhook{Url: server.URL, Events: models.WebhookEvents{events.PROBE_GOOD}, Active: true, Secret: "whsec_test"}
+	assert.Nil(t, models.CreateWebhook(nil, webhook))
+
+	webhooks, err := models.ActiveWebhooksForEvent(events.PROBE_GOOD, 42)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 1, "Webhook with no user should receive events for all users")
+
+	webhooks, err = models.ActiveWebhooksForEvent(events.PROBE_BAD, 42)
+	assert.Nil(t, err)
+	assert.Len(t, webhooks, 0)
+
+	params := map[string]interface{}{
+		"webhook_id":  webhook.ID,
+		"delivery_id": "delivery-1",
+		"event":       events.PROBE_GOOD,
+		"payload":     `{"event":"probe.good"}`,
+	}
+
+	err = dispatcher.deliver(context.Background(), params)
+	assert.Nil(t, err)
+
+	req, body := <-received, <-receivedBody
+	assert.Equal(t, `{"event":"probe.good"}`, string(body))
+	assert.Equal(t, events.PROBE_GOOD, req.Header.Get(EVENT_HEADER))
+	assert.Equal(t, "delivery-1", req.Header.Get(DELIVERY_HEADER))
+	assert.Equal(t, Sign("whsec_test", req.Header.Get(TIMESTAMP_HEADER), body), req.Header.Get(SIGNATURE_HEADER))
+
+	// Failed deliveries fail the job, so they're retried
+	responseStatus = http.StatusInternalServerError
+	err = dispatcher.deliver(context.Background(), params)
+	assert.NotNil(t, err)
+	<-received
+	<-receivedBody
+
+	deliveries, _, err := models.FetchWebhookDeliveries(webhook.ID, 1)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, 2, deliveries[0].Attempt)
+	assert.False(t, deliveries[0].Successful)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].StatusCode)
+	assert.True(t, deliveries[1].Successful)
+
+	// Cancelled deliveries are never sent e.g. when the job times out
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = dispatcher.deliver(ctx, params)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+	assert.Len(t, received, 0)
+
+	// Deliveries to deleted webhooks are skipped
+	assert.Nil(t, models.DeleteWebhook(webhook))
+	assert.Nil(t, dispatcher.deliver(context.Background(), params))
+}
+
+func TestValidateUrl(t *testing.T) {
+	forbiddenUrls := []string{
+		"http://127.0.0.1:3900/v1/jobs",
+		"http://localhost",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+	}
+	for _, forbiddenUrl := range forbiddenUrls {
+		assert.Equal(t, ErrForbiddenUrlAddress, ValidateUrl(forbiddenUrl), forbiddenUrl)
+	}
+
+	assert.Equal(t, ErrInvalidUrl, ValidateUrl("ftp://93.184.216.34/hook"))
+	assert.Equal(t, ErrInvalidUrl, ValidateUrl("https:///hook"))
+	assert.Equal(t, ErrUnresolvableUrl, ValidateUrl("https://kronus.invalid/hook"))
+
+	assert.Nil(t, ValidateUrl("https://93.184.216.34/hook"))
+}
+
+func TestDeliverToForbiddenAddress(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	dispatcher, err := NewDispatcher(workerPool)
+	assert.Nil(t, err)
+
+	received := make(chan bool, 2)
+	privateServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		received <- true
+	}))
+	defer privateServer.Close()
+
+	// Only the server which redirects to the private server is "public"
+	redirectServer := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, privateServer.URL, http.StatusTemporaryRedirect)
+	}))
+	redirectServer.Listener.Close()
+	redirectServer.Listener, err = net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("can't listen on 127.0.0.2: %v", err)
+	}
+	redirectServer.Start()
+	defer redirectServer.Close()
+
+	allowIPs(t, func(ip net.IP) bool { return ip.Equal(net.ParseIP("127.0.0.2")) })
+
+	for _, hookUrl := range []string{privateServer.URL, redirectServer.URL} {
+		webhook := &models.Webhook{Url: hookUrl, Events: models.WebhookEvents{events.PROBE_GOOD}, Active: true, Secret: "whsec_test"}
+		assert.Nil(t, models.CreateWebhook(nil, webhook))
+
+		err = dispatcher.deliver(context.Background(), map[string]interface{}{
+			"webhook_id":  webhook.ID,
+			"delivery_id": "forbidden-delivery",
+			"event":       events.PROBE_GOOD,
+			"payload":     `{"event":"probe.good"}`,
+		})
+		assert.NotNil(t, err, hookUrl)
+
+		deliveries, _, err := models.FetchWebhookDeliveries(webhook.ID, 1)
+		assert.Nil(t, err)
+		assert.Len(t, deliveries, 1)
+		assert.False(t, deliveries[0].Successful)
+		assert.Contains(t, deliveries[0].Error, ErrForbiddenUrlAddress.Error())
+
+		assert.Nil(t, models.DeleteWebhook(webhook))
+	}
+
+	assert.Len(t, received, 0, "Private server should never be reached")
+}
+
+func TestDispatch(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := work.NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	_, err = NewDispatcher(workerPool)
+	assert.Nil(t, err)
+
+	webhook := &models.Webhook{Url: "https://93.184.216.34/hook", Events: models.WebhookEvents{events.PROBE_BAD}, Active: true, Secret: "whsec_test"}
+	assert.Nil(t, models.CreateWebhook(nil, webhook))
+	defer models.DeleteWebhook(webhook)
+
+	events.Publish(events.PROBE_BAD, 7, "bad probe")
+
+	deliveryJobs := func() []models.Job {
+		jobs, _, err := models.FetchJobs(1)
+		assert.Nil(t, err)
+
+		webhookJobs := []models.Job{}
+		for _, job := range jobs {
+			if job.Handler == DELIVER_WEBHOOK_HANDLER && strings.Contains(job.Args, fmt.Sprintf(`"webhook_id":%v`, webhook.ID)) {
+				webhookJobs = append(webhookJobs, job)
+			}
+		}
+		return webhookJobs
+	}
+	assert.Eventually(t, func() bool { return len(deliveryJobs()) > 0 }, 5*time.Second, 50*time.Millisecond,
+		"Expected a delivery to be enqueued for the published event")
+
+	for _, job := range deliveryJobs() {
+		assert.Equal(t, work.WEBHOOKS_QUEUE, job.Queue)
+		assert.Contains(t, job.Args, events.PROBE_BAD)
+		assert.Nil(t, models.DeleteJob(job.ID))
+	}
+}
@@ -1,27 +1,79 @@
 package work
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/Daskott/kronus/server/cron"
 	"github.com/Daskott/kronus/server/models"
 	"github.com/go-co-op/gocron"
+	"gorm.io/gorm"
 )
 
+// The no. of workers for each queue, unless configured otherwise
 const MAX_CONCURRENCY = 1
 
-var ErrJobNotFoundInCronSch = errors.New("handler with provided name already mapped")
+// Named queues, each processed by its own workers so jobs in one queue can't hold up another's
+const (
+	DEFAULT_QUEUE     = models.DEFAULT_JOB_QUEUE
+	MESSAGES_QUEUE    = "messages"
+	MAINTENANCE_QUEUE = "maintenance"
+	WEBHOOKS_QUEUE    = "webhooks"
+)
+
+// Job priorities, jobs with a higher priority are picked up from their queue first
+const (
+	LOW_PRIORITY     = 1
+	NORMAL_PRIORITY  = models.DEFAULT_JOB_PRIORITY
+	HIGH_PRIORITY    = 3
+	HIGHEST_PRIORITY = 4
+)
+
+// DefaultQueues are the queues every worker pool adapter has, with their default no. of workers
+var DefaultQueues = map[string]int{
+	DEFAULT_QUEUE:     MAX_CONCURRENCY,
+	MESSAGES_QUEUE:    MAX_CONCURRENCY,
+	MAINTENANCE_QUEUE: MAX_CONCURRENCY,
+	WEBHOOKS_QUEUE:    MAX_CONCURRENCY,
+}
+
+var (
+	ErrJobNotFoundInCronSch = errors.New("no periodic job with provided tag")
+	ErrUnknownHandler       = errors.New("no handler registered with provided name")
+	ErrUnknownQueue         = errors.New("no workers for queue with provided name")
+	ErrInvalidPriority      = fmt.Errorf("priority must be between %v & %v", LOW_PRIORITY, HIGHEST_PRIORITY)
+)
 
 type WorkerPoolAdapter struct {
 	cronScheduler            *gocron.Scheduler
 	pool                     workerPool
 	useCronParserWithSeconds bool
+
+	// Cron schedulers for periodic jobs in time zones other than 'cronScheduler's, keyed by time zone
+	cronSchedulers   map[string]*gocron.Scheduler
+	cronSchedulersMu sync.Mutex
+	started          bool
 }
 
 func NewWorkerAdapter(timeZoneArg string, useCronParserWithSeconds bool) (*WorkerPoolAdapter, error) {
-	workerPool, err := newWorkerPool(MAX_CONCURRENCY)
+	return NewWorkerAdapterWithQueues(timeZoneArg, useCronParserWithSeconds, nil)
+}
+
+// NewWorkerAdapterWithQueues creates an adapter with the 'DefaultQueues', along with 'queues' i.e. the no. of workers
+// for each named queue. Queues in 'queues' override the no. of workers for any of the 'DefaultQueues'.
+func NewWorkerAdapterWithQueues(timeZoneArg string, useCronParserWithSeconds bool, queues map[string]int) (*WorkerPoolAdapter, error) {
+	allQueues := make(map[string]int)
+	for queue, concurrency := range DefaultQueues {
+		allQueues[queue] = concurrency
+	}
+	for queue, concurrency := range queues {
+		allQueues[queue] = concurrency
+	}
+
+	workerPool, err := newWorkerPoolWithQueues(allQueues)
 	if err != nil {
 		return nil, err
 	}
@@ -30,13 +82,26 @@ func NewWorkerAdapter(timeZoneArg string, useCronParserWithSeconds bool) (*Worke
 		cronScheduler:            cron.NewCronScheduler(timeZoneArg),
 		pool:                     *workerPool,
 		useCronParserWithSeconds: useCronParserWithSeconds,
+		cronSchedulers:           make(map[string]*gocron.Scheduler),
 	}, nil
 }
 
-// Start starts the cron scheduler & worker pool
+// Start starts the cron scheduler & worker pool.
+// Periodic jobs saved in the db that haven't been scheduled yet e.g. since the last restart, are scheduled first.
 func (adapter *WorkerPoolAdapter) Start() error {
 	logg.Info("Starting cron scheduler & worker pool")
-	adapter.cronScheduler.StartAsync()
+	err := adapter.loadPeriodicJobs()
+	if err != nil {
+		return err
+	}
+
+	adapter.cronSchedulersMu.Lock()
+	for _, cronScheduler := range adapter.allCronSchedulers() {
+		cronScheduler.StartAsync()
+	}
+	adapter.started = true
+	adapter.cronSchedulersMu.Unlock()
+
 	adapter.pool.start()
 
 	return nil
@@ -45,15 +110,38 @@ func (adapter *WorkerPoolAdapter) Start() error {
 // Stop stops the cron scheduler & worker pool
 func (adapter *WorkerPoolAdapter) Stop() error {
 	logg.Info("Stopping cron scheduler & worker pool")
-	adapter.cronScheduler.Stop()
+	adapter.cronSchedulersMu.Lock()
+	for _, cronScheduler := range adapter.allCronSchedulers() {
+		cronScheduler.Stop()
+	}
+	adapter.started = false
+	adapter.cronSchedulersMu.Unlock()
+
 	adapter.pool.stop()
 
 	return nil
 }
 
+// Location returns the default time zone periodic jobs are scheduled in
+func (adapter *WorkerPoolAdapter) Location() *time.Location {
+	return adapter.cronScheduler.Location()
+}
+
 // Register binds a name to a handler.
 func (adapter *WorkerPoolAdapter) Register(name string, handler Handler) error {
-	return adapter.pool.registerHandler(name, handler)
+	return adapter.pool.registerHandler(name, WithContext(handler), HandlerOptions{})
+}
+
+// RegisterWithOptions binds a name to a handler, with 'options' used as the defaults for its jobs
+// e.g. the priority of each job performed by the handler.
+func (adapter *WorkerPoolAdapter) RegisterWithOptions(name string, handler Handler, options HandlerOptions) error {
+	return adapter.pool.registerHandler(name, WithContext(handler), options)
+}
+
+// RegisterContext binds a name to a handler that's passed a context, which is cancelled when
+// a job runs longer than the timeout in 'options' or the worker pool is stopped.
+func (adapter *WorkerPoolAdapter) RegisterContext(name string, handler ContextHandler, options HandlerOptions) error {
+	return adapter.pool.registerHandler(name, handler, options)
 }
 
 // Perform sends a new job to the queue to be executed as soon as a worker is available
@@ -86,58 +174,173 @@ func (adapter *WorkerPoolAdapter) PerformIn(secondsInFuture int, job JobParams)
 	return nil
 }
 
+// PerformAt sends a new job to the queue at 'addToQueueAt', to be executed
+func (adapter *WorkerPoolAdapter) PerformAt(addToQueueAt time.Time, job JobParams) error {
+	logg.Infof("Scheduling job: %v, to run at %v", job, addToQueueAt)
+
+	err := adapter.pool.enqueueAt(addToQueueAt, job)
+	if err != nil {
+		return fmt.Errorf("error scheduling job: %v, %v", job, err)
+	}
+
+	return nil
+}
+
+// Retry moves the dead job with 'jobID' back to the queue, to be executed with its fails reset
+func (adapter *WorkerPoolAdapter) Retry(jobID interface{}) (*models.Job, error) {
+	job, err := models.FindJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !adapter.pool.hasHandler(job.Handler) {
+		return nil, ErrUnknownHandler
+	}
+
+	logg.Infof("Retrying dead job with id=%v", job.ID)
+	job, err = models.RetryDeadJob(job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter.pool.notifier.notifyQueue(job.Queue)
+	return job, nil
+}
+
+// RetryAll moves all dead jobs for 'handler' back to the queue, and returns the no. of jobs retried
+func (adapter *WorkerPoolAdapter) RetryAll(handler string) (int64, error) {
+	if !adapter.pool.hasHandler(handler) {
+		return 0, ErrUnknownHandler
+	}
+
+	retried, err := models.RetryDeadJobsByHandler(handler)
+	logg.Infof("Retried %v dead job(s) for handler=%v", retried, handler)
+
+	if retried > 0 {
+		adapter.pool.notifier.notifyAllQueues()
+	}
+
+	return retried, err
+}
+
+// Cancel removes the scheduled job with 'jobID' before it's added to the queue
+func (adapter *WorkerPoolAdapter) Cancel(jobID interface{}) error {
+	logg.Infof("Cancelling scheduled job with id=%v", jobID)
+	return models.CancelScheduledJob(jobID)
+}
+
 // PeriodicallyPerform adds a job to the queue periodically (to be executed),
-// based on the 'cronExpression' expression provided.
+// based on the 'cronExpression' expression provided. The job's definition is saved in the db,
+// and replaces any periodic job with the same name. If that job was paused, it stays paused.
 //
 // NOTE: All enqueued jobs are unique by name.
-//if a duplicate is added, an error is logged when the internal cron scheduler tries to add it
+// if a duplicate is added, an error is logged when the internal cron scheduler tries to add it
 // the job to the job queue.
 func (adapter *WorkerPoolAdapter) PeriodicallyPerform(cronExpression string, job JobParams) error {
-	var scheduler *gocron.Scheduler
+	cronScheduler, err := adapter.cronSchedulerFor(job.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	nextRunAt, err := adapter.nextRunAt(cronExpression, cronScheduler.Location())
+	if err != nil {
+		return err
+	}
+
+	argsAsJson, err := json.Marshal(job.Args)
+	if err != nil {
+		return err
+	}
+
+	periodicJob := models.PeriodicJob{
+		Name:           job.Name,
+		Handler:        job.Handler,
+		Queue:          job.Queue,
+		Priority:       job.Priority,
+		Args:           string(argsAsJson),
+		CronExpression: cronExpression,
+		TimeZone:       cronScheduler.Location().String(),
+		NextRunAt:      &nextRunAt,
+	}
+	err = models.SavePeriodicJob(&periodicJob)
+	if err != nil {
+		return err
+	}
 
-	// The scheduler will use a cron parser that expects a 6th field for seconds
-	if adapter.useCronParserWithSeconds {
-		scheduler = adapter.cronScheduler.CronWithSeconds(cronExpression)
-	} else {
-		scheduler = adapter.cronScheduler.Cron(cronExpression)
+	adapter.unschedulePeriodicJob(job.Name)
+	if periodicJob.Paused {
+		logg.Infof("Periodic job %v is paused, so it won't be scheduled until it's resumed", job.Name)
+		return periodicJob.Update(map[string]interface{}{"next_run_at": nil})
 	}
 
-	_, err := scheduler.Tag(job.Name).
-		Do(
-			func(job JobParams) {
-				err := adapter.Perform(job)
-				if err != nil {
-					logg.Error(err)
-				}
-			},
-			job,
-		)
-	return err
+	return adapter.schedulePeriodicJob(cronScheduler, cronExpression, job)
 }
 
+// RemovePeriodicJob removes the periodic job with 'jobName', whatever time zone it's scheduled in,
+// along with its definition in the db
 func (adapter *WorkerPoolAdapter) RemovePeriodicJob(jobName string) {
-	adapter.cronScheduler.RemoveByTag(jobName)
+	adapter.unschedulePeriodicJob(jobName)
+
+	err := models.DeletePeriodicJobByName(jobName)
+	if err != nil {
+		logg.Error(err)
+	}
 }
 
+// UpdateJobScheduleByTag reschedules the periodic job tagged with 'tag' i.e. the job named 'tag',
+// to be added to the queue based on 'cronExpression'. The new schedule is saved in the db.
 func (adapter *WorkerPoolAdapter) UpdateJobScheduleByTag(tag, cronExpression string) error {
-	var job *gocron.Job
-
-	// Find job by tag in cronScheduler
-	for _, j := range adapter.cronScheduler.Jobs() {
-		if strings.Contains(strings.Join(j.Tags(), ","), tag) {
-			job = j
-			break
-		}
+	periodicJob, err := models.FindPeriodicJobByName(tag)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrJobNotFoundInCronSch
 	}
 
-	if job == nil {
-		return ErrJobNotFoundInCronSch
+	if err != nil {
+		return err
 	}
 
-	_, err := adapter.cronScheduler.Job(job).Cron(cronExpression).Update()
+	job, err := jobParamsFor(periodicJob)
 	if err != nil {
-		logg.Error(err)
+		return err
 	}
 
-	return nil
+	return adapter.PeriodicallyPerform(cronExpression, job)
+}
+
+// cronSchedulerFor returns the cron scheduler for 'timeZone', creating one if needed.
+// An empty 'timeZone' returns the default cron scheduler.
+func (adapter *WorkerPoolAdapter) cronSchedulerFor(timeZone string) (*gocron.Scheduler, error) {
+	if timeZone == "" || timeZone == adapter.cronScheduler.Location().String() {
+		return adapter.cronScheduler, nil
+	}
+
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return nil, err
+	}
+
+	adapter.cronSchedulersMu.Lock()
+	defer adapter.cronSchedulersMu.Unlock()
+
+	cronScheduler, ok := adapter.cronSchedulers[timeZone]
+	if !ok {
+		cronScheduler = cron.NewCronScheduler(timeZone)
+		adapter.cronSchedulers[timeZone] = cronScheduler
+
+		if adapter.started {
+			cronScheduler.StartAsync()
+		}
+	}
+
+	return cronScheduler, nil
+}
+
+// allCronSchedulers returns the default cron scheduler, and the ones for other time zones.
+// 'cronSchedulersMu' must be held by the caller.
+func (adapter *WorkerPoolAdapter) allCronSchedulers() []*gocron.Scheduler {
+	cronSchedulers := []*gocron.Scheduler{adapter.cronScheduler}
+	for _, cronScheduler := range adapter.cronSchedulers {
+		cronSchedulers = append(cronSchedulers, cronScheduler)
+	}
+
+	return cronSchedulers
 }
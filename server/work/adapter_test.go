@@ -2,11 +2,16 @@ package work
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/Daskott/kronus/server/events"
 	"github.com/Daskott/kronus/server/models"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func TestPerformIn(t *testing.T) {
@@ -46,3 +51,535 @@ func TestPerformIn(t *testing.T) {
 	outStr = outputBuffer.String()
 	assert.Equal(t, "Hello", outStr, "Expected job to write to outputBuffer")
 }
+
+func TestPeriodicallyPerformInTimeZone(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	outputBuffer := new(bytes.Buffer)
+	workerPool.Register("write_to_buffer_in_tz", func(m map[string]interface{}) error {
+		_, err := outputBuffer.WriteString("Hello")
+		return err
+	})
+
+	err = workerPool.PeriodicallyPerform("*/1 * * * * *", JobParams{
+		Name:     "write_to_buffer_in_tz",
+		Handler:  "write_to_buffer_in_tz",
+		Args:     map[string]interface{}{},
+		TimeZone: "Not/A_Zone",
+	})
+	assert.NotNil(t, err, "Expected an invalid time zone to be rejected")
+
+	err = workerPool.PeriodicallyPerform("*/1 * * * * *", JobParams{
+		Name:     "write_to_buffer_in_tz",
+		Handler:  "write_to_buffer_in_tz",
+		Args:     map[string]interface{}{},
+		TimeZone: "America/Toronto",
+	})
+	assert.Nil(t, err)
+
+	cronScheduler, err := workerPool.cronSchedulerFor("America/Toronto")
+	assert.Nil(t, err)
+	assert.Len(t, cronScheduler.Jobs(), 1, "Expected job to be scheduled in its own time zone")
+	assert.Len(t, workerPool.cronScheduler.Jobs(), 0)
+
+	workerPool.Start()
+	time.Sleep(3 * time.Second)
+	workerPool.RemovePeriodicJob("write_to_buffer_in_tz")
+	workerPool.Stop()
+
+	assert.Contains(t, outputBuffer.String(), "Hello", "Expected job to write to outputBuffer")
+	assert.Len(t, cronScheduler.Jobs(), 0, "Expected job to be removed")
+}
+
+func TestPerformPublishesJobEvents(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	workerPool.RegisterWithOptions("always_fails", func(m map[string]interface{}) error {
+		return errors.New("nope")
+	}, HandlerOptions{MaxAttempts: 2, Backoff: &BackoffPolicy{InitialInterval: time.Millisecond}})
+
+	stream, unsubscribe := events.SubscribeChan(32)
+	defer unsubscribe()
+
+	err = workerPool.Perform(JobParams{Name: "always_fails", Handler: "always_fails", Args: map[string]interface{}{}})
+	assert.Nil(t, err)
+
+	workerPool.Start()
+	assert.Eventually(t, func() bool {
+		jobs, _, err := models.FetchJobsByStatus(models.DEAD_JOB, 1)
+		return err == nil && len(jobs) == 1
+	}, 15*time.Second, 100*time.Millisecond, "Expected job to be dead after its max attempts")
+	workerPool.Stop()
+
+	eventTypes := []string{}
+	for len(stream) > 0 {
+		event := <-stream
+		job, ok := event.Data.(models.Job)
+		if ok && job.Name == "always_fails" {
+			eventTypes = append(eventTypes, event.Type)
+		}
+	}
+
+	assert.Equal(t, []string{
+		events.JOB_ENQUEUED,
+		events.JOB_IN_PROGRESS, events.JOB_SCHEDULED,
+		events.JOB_ENQUEUED,
+		events.JOB_IN_PROGRESS, events.JOB_DEAD,
+	}, eventTypes)
+}
+
+func TestPerformDuplicateJobIsNotPublished(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	workerPool.Register("publish_once", func(m map[string]interface{}) error { return nil })
+
+	stream, unsubscribe := events.SubscribeChan(32)
+	defer unsubscribe()
+
+	job := JobParams{Name: "publish_once", Handler: "publish_once", Args: map[string]interface{}{}}
+	assert.Nil(t, workerPool.Perform(job))
+	assert.Nil(t, workerPool.Perform(job))
+
+	// Run the job, so it's not left in the queue for the other tests
+	workerPool.Start()
+	assert.Eventually(t, func() bool {
+		jobs, _, err := models.FetchJobsByStatus(models.SUCCESSFUL_JOB, 1)
+		return err == nil && len(jobs) > 0 && jobs[0].Name == "publish_once"
+	}, 5*time.Second, 100*time.Millisecond, "Expected job to run")
+	workerPool.Stop()
+
+	enqueuedEvents := 0
+	for len(stream) > 0 {
+		event := <-stream
+		job, ok := event.Data.(models.Job)
+		if ok && job.Name == "publish_once" && event.Type == events.JOB_ENQUEUED {
+			enqueuedEvents++
+		}
+	}
+
+	assert.Equal(t, 1, enqueuedEvents, "Expected 'job.enqueued' to only be published for the new job")
+}
+
+func TestPerformDuplicateOfJobInBackoff(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	attempts := make(chan bool, 4)
+	workerPool.RegisterWithOptions("fails_once", func(m map[string]interface{}) error {
+		attempts <- true
+		return errors.New("nope")
+	}, HandlerOptions{MaxAttempts: 2, Backoff: &BackoffPolicy{InitialInterval: time.Hour}})
+
+	// jobsNamed returns the jobs with 'name', as jobs from other tests share the db
+	jobsNamed := func(name string) []models.Job {
+		jobs, _, err := models.FetchJobs(1)
+		assert.Nil(t, err)
+
+		namedJobs := []models.Job{}
+		for _, job := range jobs {
+			if job.Name == name {
+				namedJobs = append(namedJobs, job)
+			}
+		}
+		return namedJobs
+	}
+
+	job := JobParams{Name: "fails_once-1", Handler: "fails_once", Args: map[string]interface{}{}}
+	assert.Nil(t, workerPool.Perform(job))
+
+	workerPool.Start()
+
+	inBackoff := func() bool {
+		jobs := jobsNamed(job.Name)
+		return len(jobs) == 1 && jobs[0].Fails == 1 && jobs[0].JobStatus.Name == models.SCHEDULED_JOB
+	}
+	assert.Eventually(t, inBackoff, 10*time.Second, 100*time.Millisecond, "Expected failed job to be scheduled for a retry")
+
+	// The job is already waiting to be retried, so the duplicate isn't enqueued
+	assert.Nil(t, workerPool.Perform(job))
+	assert.Len(t, jobsNamed(job.Name), 1, "Expected no duplicate job while the original is in backoff")
+
+	time.Sleep(2 * time.Second)
+	assert.Len(t, attempts, 1, "Expected only the original attempt")
+
+	// A job scheduled by 'PerformIn' hasn't failed, so it's no duplicate
+	scheduledJob := JobParams{Name: "fails_once-2", Handler: "fails_once", Args: map[string]interface{}{}}
+	assert.Nil(t, workerPool.PerformIn(60, scheduledJob))
+	assert.Nil(t, workerPool.Perform(scheduledJob))
+	assert.Len(t, jobsNamed(scheduledJob.Name), 2)
+
+	// Remove the jobs, so they're not left in the queue for the other tests
+	workerPool.Stop()
+	for _, job := range append(jobsNamed(job.Name), jobsNamed(scheduledJob.Name)...) {
+		assert.Nil(t, models.DeleteJob(job.ID))
+	}
+}
+
+func TestRetryAndCancel(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	workerPool.Register("mark_dead", func(m map[string]interface{}) error { return nil })
+
+	deadStatus, err := models.FindJobStatus(models.DEAD_JOB)
+	assert.Nil(t, err)
+
+	killJob := func(name string) *models.Job {
+		assert.Nil(t, workerPool.Perform(JobParams{Name: name, Handler: "mark_dead", Args: map[string]interface{}{}}))
+
+		jobs, _, err := models.FetchJobsByStatus(models.ENQUEUED_JOB, 1)
+		assert.Nil(t, err)
+		job := jobs[0]
+		assert.Equal(t, name, job.Name)
+		assert.Nil(t, job.Update(map[string]interface{}{"job_status_id": deadStatus.ID, "fails": MAX_FAILS, "last_error": "boom"}))
+
+		return &job
+	}
+
+	deadJob := killJob("mark_dead-1")
+
+	job, err := workerPool.Retry(deadJob.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, models.ENQUEUED_JOB, job.JobStatus.Name)
+	assert.Equal(t, 0, job.Fails, "Should reset fails")
+
+	_, err = workerPool.Retry(deadJob.ID)
+	assert.ErrorIs(t, err, models.ErrJobNotDead)
+
+	// A dead job can't be retried while a job with the same name is already in the queue
+	duplicate := killJob("mark_dead-2")
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "mark_dead-2", Handler: "mark_dead", Args: map[string]interface{}{}}))
+	_, err = workerPool.Retry(duplicate.ID)
+	assert.ErrorIs(t, err, models.ErrDuplicateJob)
+
+	killJob("mark_dead-3")
+	killJob("mark_dead-4")
+	retried, err := workerPool.RetryAll("mark_dead")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), retried, "Should skip the dead job with a duplicate in the queue")
+
+	_, err = workerPool.RetryAll("unknown")
+	assert.ErrorIs(t, err, ErrUnknownHandler)
+
+	// Only scheduled jobs can be cancelled
+	assert.ErrorIs(t, workerPool.Cancel(job.ID), models.ErrJobNotScheduled)
+
+	assert.Nil(t, workerPool.PerformIn(60, JobParams{Name: "mark_dead-5", Handler: "mark_dead", Args: map[string]interface{}{}}))
+	jobs, _, err := models.FetchJobsByStatus(models.SCHEDULED_JOB, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, workerPool.Cancel(jobs[0].ID))
+
+	_, err = models.FindJob(jobs[0].ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestQueues(t *testing.T) {
+	models.InitializeTestDb()
+
+	_, err := NewWorkerAdapterWithQueues("UTC", true, map[string]int{"empty": 0})
+	assert.NotNil(t, err, "Should require at least 1 worker for each queue")
+
+	workerPool, err := NewWorkerAdapterWithQueues("UTC", true, map[string]int{MESSAGES_QUEUE: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, workerPool.pool.queues[MESSAGES_QUEUE])
+	assert.Equal(t, MAX_CONCURRENCY, workerPool.pool.queues[MAINTENANCE_QUEUE])
+
+	release := make(chan struct{})
+	sent := make(chan string, 1)
+	workerPool.Register("slow_backup", func(m map[string]interface{}) error {
+		<-release
+		return nil
+	})
+	workerPool.Register("send_message", func(m map[string]interface{}) error {
+		sent <- fmt.Sprint(m["to"])
+		return nil
+	})
+
+	err = workerPool.Perform(JobParams{Name: "send_message-unknown", Handler: "send_message", Queue: "unknown"})
+	assert.NotNil(t, err, "Should not enqueue jobs for a queue with no workers")
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "slow_backup", Handler: "slow_backup", Queue: MAINTENANCE_QUEUE}))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "send_message", Handler: "send_message", Queue: MESSAGES_QUEUE,
+		Args: map[string]interface{}{"to": "mike"}}))
+
+	select {
+	case to := <-sent:
+		assert.Equal(t, "mike", to)
+	case <-time.After(3 * time.Second):
+		t.Error("A slow job in the maintenance queue should not hold up the messages queue")
+	}
+
+	close(release)
+}
+
+func TestPriorities(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	processed := make(chan string, 3)
+	recordName := func(m map[string]interface{}) error {
+		processed <- fmt.Sprint(m["name"])
+		return nil
+	}
+	workerPool.Register("routine", recordName)
+	workerPool.RegisterWithOptions("emergency", recordName, HandlerOptions{Priority: HIGHEST_PRIORITY})
+
+	err = workerPool.RegisterWithOptions("invalid", recordName, HandlerOptions{Priority: HIGHEST_PRIORITY + 1})
+	assert.ErrorIs(t, err, ErrInvalidPriority)
+
+	err = workerPool.Perform(JobParams{Name: "routine-invalid", Handler: "routine", Priority: -1})
+	assert.NotNil(t, err, "Should not enqueue jobs with an invalid priority")
+
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "routine-low", Handler: "routine", Priority: LOW_PRIORITY,
+		Args: map[string]interface{}{"name": "routine-low"}}))
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "routine", Handler: "routine",
+		Args: map[string]interface{}{"name": "routine"}}))
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "emergency", Handler: "emergency",
+		Args: map[string]interface{}{"name": "emergency"}}))
+
+	stats, err := models.CurrentJobsStats()
+	assert.Nil(t, err)
+	assert.Len(t, stats.ByPriority, 3)
+	assert.Equal(t, HIGHEST_PRIORITY, stats.ByPriority[0].Priority, "Should order stats from the highest priority")
+	assert.Equal(t, int64(1), stats.ByPriority[0].EnueuedJobCount)
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	for _, expected := range []string{"emergency", "routine", "routine-low"} {
+		select {
+		case name := <-processed:
+			assert.Equal(t, expected, name, "Jobs should be processed from the highest priority")
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Expected job '%v' to be processed", expected)
+		}
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	options := HandlerOptions{MaxAttempts: 1, Timeout: 100 * time.Millisecond}
+	workerPool.RegisterContext("hangs", func(ctx context.Context, m map[string]interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, options)
+
+	// Handlers without a context can't be cancelled, so the worker waits for them to return
+	started := make(chan struct{})
+	release := make(chan struct{})
+	workerPool.RegisterWithOptions("hangs_without_context", func(m map[string]interface{}) error {
+		close(started)
+		<-release
+		return errors.New("gave up")
+	}, options)
+
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "hangs", Handler: "hangs"}))
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "hangs_without_context", Handler: "hangs_without_context"}))
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	jobNamed := func(status, name string) *models.Job {
+		jobs, _, err := models.FetchJobsByStatus(status, 1)
+		assert.Nil(t, err)
+
+		for _, job := range jobs {
+			if job.Name == name {
+				return &job
+			}
+		}
+		return nil
+	}
+
+	assert.Eventually(t, func() bool { return jobNamed(models.DEAD_JOB, "hangs") != nil },
+		5*time.Second, 100*time.Millisecond, "Expected job that timed out to fail")
+	assert.Contains(t, jobNamed(models.DEAD_JOB, "hangs").LastError, "timed out")
+
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected job without context to be started")
+	}
+
+	// Long past its timeout, the job is still in progress as its handler hasn't returned
+	time.Sleep(500 * time.Millisecond)
+	assert.NotNil(t, jobNamed(models.IN_PROGRESS_JOB, "hangs_without_context"),
+		"Job should not be failed or released while its handler is running")
+
+	close(release)
+	assert.Eventually(t, func() bool { return jobNamed(models.DEAD_JOB, "hangs_without_context") != nil },
+		5*time.Second, 100*time.Millisecond, "Expected job that timed out to fail once its handler returned")
+	assert.Contains(t, jobNamed(models.DEAD_JOB, "hangs_without_context").LastError, "timed out")
+}
+
+func TestStopReleasesJobsInProgress(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	started := make(chan struct{})
+	workerPool.RegisterContext("long_running", func(ctx context.Context, m map[string]interface{}) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, HandlerOptions{})
+
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "long_running", Handler: "long_running"}))
+	workerPool.Start()
+
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected job to be started")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		workerPool.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Stop should not wait for jobs in progress to finish")
+	}
+
+	jobs, _, err := models.FetchJobsByStatus(models.ENQUEUED_JOB, 1)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, jobs)
+	assert.Equal(t, "long_running", jobs[0].Name, "Expected job in progress to be released back to the queue")
+	assert.Equal(t, 0, jobs[0].Fails, "A released job should not count as failed")
+	assert.False(t, jobs[0].Claimed)
+}
+
+func TestIdleWorkersAreWokenUp(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	processed := make(chan string, 2)
+	workerPool.Register("wake_up", func(m map[string]interface{}) error {
+		processed <- fmt.Sprint(m["name"])
+		return nil
+	})
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	// Wait for the workers & requeuers to back off from polling an empty queue
+	time.Sleep(2500 * time.Millisecond)
+
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "wake_up-now", Handler: "wake_up",
+		Args: map[string]interface{}{"name": "now"}}))
+
+	select {
+	case name := <-processed:
+		assert.Equal(t, "now", name)
+	case <-time.After(time.Second):
+		t.Fatal("Expected an idle worker to be woken up when a job is enqueued")
+	}
+
+	assert.Nil(t, workerPool.PerformIn(1, JobParams{Name: "wake_up-soon", Handler: "wake_up",
+		Args: map[string]interface{}{"name": "soon"}}))
+
+	nextAt, err := models.NextScheduledJobAt()
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Second), nextAt, time.Second)
+
+	select {
+	case name := <-processed:
+		assert.Equal(t, "soon", name)
+	case <-time.After(4 * time.Second):
+		t.Fatal("Expected the scheduled job requeuer to wake up when the scheduled job is due")
+	}
+}
+
+func TestJobAttemptsAreRecorded(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	calls := 0
+	options := HandlerOptions{MaxAttempts: 3, Backoff: &BackoffPolicy{InitialInterval: time.Millisecond}}
+	workerPool.RegisterWithOptions("flaky", func(m map[string]interface{}) error {
+		calls++
+		if calls == 1 {
+			return errors.New("twilio is down")
+		}
+		return nil
+	}, options)
+
+	assert.Nil(t, workerPool.Perform(JobParams{Name: "flaky", Handler: "flaky"}))
+
+	workerPool.Start()
+	defer workerPool.Stop()
+
+	flakyJob := func() *models.Job {
+		jobs, _, err := models.FetchJobsByStatus(models.SUCCESSFUL_JOB, 1)
+		assert.Nil(t, err)
+
+		for _, job := range jobs {
+			if job.Name == "flaky" {
+				return &job
+			}
+		}
+		return nil
+	}
+
+	assert.Eventually(t, func() bool { return flakyJob() != nil },
+		10*time.Second, 100*time.Millisecond, "Expected flaky job to succeed when retried")
+
+	attempts, paging, err := models.FetchJobAttempts(flakyJob().ID, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), paging.Total)
+	assert.Len(t, attempts, 2)
+
+	// Latest attempt first
+	assert.Equal(t, 2, attempts[0].Attempt)
+	assert.Equal(t, models.SUCCEEDED_JOB_ATTEMPT, attempts[0].Outcome)
+	assert.Empty(t, attempts[0].Error)
+
+	assert.Equal(t, 1, attempts[1].Attempt)
+	assert.Equal(t, models.FAILED_JOB_ATTEMPT, attempts[1].Outcome)
+	assert.Equal(t, "twilio is down", attempts[1].Error)
+
+	for _, attempt := range attempts {
+		assert.NotEmpty(t, attempt.WorkerID)
+		assert.False(t, attempt.EndedAt.Before(attempt.StartedAt))
+	}
+
+	// A job's attempts are deleted with it
+	jobID := flakyJob().ID
+	assert.Nil(t, models.DeleteJob(jobID))
+
+	_, paging, err = models.FetchJobAttempts(jobID, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), paging.Total)
+}
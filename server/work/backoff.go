@@ -0,0 +1,84 @@
+package work
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+)
+
+// BackoffPolicy determines how long a failed job waits before it's retried i.e. 'InitialInterval' after its
+// first failure, multiplied by 'Multiplier' after each failure after that, up to 'MaxInterval'.
+type BackoffPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+
+	// The fraction of each interval that's randomised e.g. 0.2 for +/- 20%,
+	// so jobs that failed at the same time e.g. during a Twilio outage, aren't all retried at the same time
+	Jitter float64
+}
+
+// DefaultBackoffPolicy is used for the jobs of handlers registered without a backoff policy
+var DefaultBackoffPolicy = BackoffPolicy{
+	InitialInterval: 15 * time.Second,
+	MaxInterval:     10 * time.Minute,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// Delay returns how long to wait before retrying a job that has failed 'fails' times
+func (policy BackoffPolicy) Delay(fails int) time.Duration {
+	if fails < 1 {
+		fails = 1
+	}
+
+	interval := float64(policy.InitialInterval) * math.Pow(policy.Multiplier, float64(fails-1))
+	if interval > float64(policy.MaxInterval) {
+		interval = float64(policy.MaxInterval)
+	}
+
+	jitterRange := int64(2 * interval * policy.Jitter)
+	if jitterRange > 0 {
+		jitter, err := rand.Int(rand.Reader, big.NewInt(jitterRange))
+		if err == nil {
+			interval += float64(jitter.Int64()) - float64(jitterRange)/2
+		}
+	}
+
+	return time.Duration(interval)
+}
+
+// withDefaults returns the policy, with any unset field taken from 'DefaultBackoffPolicy'
+func (policy BackoffPolicy) withDefaults() BackoffPolicy {
+	if policy.InitialInterval == 0 {
+		policy.InitialInterval = DefaultBackoffPolicy.InitialInterval
+	}
+
+	if policy.MaxInterval == 0 {
+		policy.MaxInterval = DefaultBackoffPolicy.MaxInterval
+	}
+
+	if policy.Multiplier == 0 {
+		policy.Multiplier = DefaultBackoffPolicy.Multiplier
+	}
+
+	return policy
+}
+
+func (policy BackoffPolicy) validate() error {
+	if policy.InitialInterval < 0 || policy.MaxInterval < 0 {
+		return fmt.Errorf("backoff intervals can't be negative")
+	}
+
+	if policy.Multiplier != 0 && policy.Multiplier < 1 {
+		return fmt.Errorf("backoff multiplier must be at least 1")
+	}
+
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("backoff jitter must be between 0 & 1")
+	}
+
+	return nil
+}
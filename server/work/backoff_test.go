@@ -0,0 +1,31 @@
+package work
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffPolicyDelay(t *testing.T) {
+	policy := BackoffPolicy{InitialInterval: 10 * time.Second, MaxInterval: time.Minute, Multiplier: 2}
+
+	assert.Equal(t, 10*time.Second, policy.Delay(1))
+	assert.Equal(t, 20*time.Second, policy.Delay(2))
+	assert.Equal(t, 40*time.Second, policy.Delay(3))
+	assert.Equal(t, time.Minute, policy.Delay(4), "Delay should not exceed the max interval")
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		delay := policy.Delay(1)
+		assert.GreaterOrEqual(t, delay, 5*time.Second)
+		assert.LessOrEqual(t, delay, 15*time.Second)
+	}
+
+	policy = BackoffPolicy{InitialInterval: time.Second}.withDefaults()
+	assert.Equal(t, DefaultBackoffPolicy.MaxInterval, policy.MaxInterval)
+	assert.Equal(t, DefaultBackoffPolicy.Multiplier, policy.Multiplier)
+
+	assert.NotNil(t, BackoffPolicy{Multiplier: 0.5}.validate())
+	assert.NotNil(t, BackoffPolicy{Jitter: 2}.validate())
+}
@@ -14,3 +14,7 @@ func makeIdentifier() string {
 	}
 	return fmt.Sprintf("%x", b)
 }
+
+func isValidPriority(priority int) bool {
+	return priority >= LOW_PRIORITY && priority <= HIGHEST_PRIORITY
+}
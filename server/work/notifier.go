@@ -0,0 +1,52 @@
+package work
+
+// notifier wakes up idle workers when jobs are added to their queue, and the scheduled job requeuer
+// when jobs are scheduled. So they don't have to wait until they next poll the db to find new jobs.
+type notifier struct {
+	queues    map[string]chan struct{}
+	scheduled chan struct{}
+}
+
+// newNotifier creates a notifier for each of the named 'queues', keyed by the no. of workers
+func newNotifier(queues map[string]int) *notifier {
+	n := notifier{
+		queues:    make(map[string]chan struct{}),
+		scheduled: make(chan struct{}, 1),
+	}
+
+	for queue, concurrency := range queues {
+		// Buffered so each idle worker for the queue can be woken up, without blocking the caller
+		n.queues[queue] = make(chan struct{}, concurrency)
+	}
+
+	return &n
+}
+
+// queue returns the channel idle workers for 'queue' are woken up on
+func (n *notifier) queue(queue string) <-chan struct{} {
+	return n.queues[queue]
+}
+
+// notifyQueue wakes up an idle worker for 'queue', if any. It never blocks.
+func (n *notifier) notifyQueue(queue string) {
+	select {
+	case n.queues[queue] <- struct{}{}:
+	default:
+	}
+}
+
+// notifyAllQueues wakes up an idle worker for every queue
+func (n *notifier) notifyAllQueues() {
+	for queue := range n.queues {
+		n.notifyQueue(queue)
+	}
+}
+
+// notifyScheduled wakes up the scheduled job requeuer, so it checks when the next scheduled job is due.
+// It never blocks.
+func (n *notifier) notifyScheduled() {
+	select {
+	case n.scheduled <- struct{}{}:
+	default:
+	}
+}
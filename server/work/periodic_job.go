@@ -0,0 +1,341 @@
+package work
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Daskott/kronus/server/models"
+	"github.com/go-co-op/gocron"
+	"github.com/robfig/cron/v3"
+)
+
+// The most occurrences of a periodic job counted as missed, so a job due every second doesn't take forever to check
+const MAX_MISSED_RUNS = 1000
+
+// MissedRun is a periodic job that was due to run, but didn't e.g. as the server was down
+type MissedRun struct {
+	PeriodicJob models.PeriodicJob
+	Job         JobParams
+
+	// When the job was last due to run
+	MissedAt time.Time
+
+	// The no. of times the job was due to run, but didn't
+	Missed int
+}
+
+// MissedRuns returns the periodic jobs for 'handler' that were due to run since they last ran,
+// within 'window' before now. Paused jobs are skipped, and jobs that never ran are checked since they were created.
+func (adapter *WorkerPoolAdapter) MissedRuns(handler string, window time.Duration) ([]MissedRun, error) {
+	periodicJobs, err := models.AllPeriodicJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	missedRuns := []MissedRun{}
+	for _, periodicJob := range periodicJobs {
+		if periodicJob.Handler != handler || periodicJob.Paused {
+			continue
+		}
+
+		lastRunAt := periodicJob.CreatedAt
+		if periodicJob.LastRunAt != nil {
+			lastRunAt = *periodicJob.LastRunAt
+		}
+
+		if lastRunAt.Before(now.Add(-window)) {
+			lastRunAt = now.Add(-window)
+		}
+
+		schedule, location, err := adapter.cronSchedule(periodicJob.CronExpression, periodicJob.TimeZone)
+		if err != nil {
+			logg.Errorf("Unable to check missed runs for periodic job %v: %v", periodicJob.Name, err)
+			continue
+		}
+
+		missedRun := MissedRun{PeriodicJob: periodicJob}
+		dueAt := schedule.Next(lastRunAt.In(location))
+		for !dueAt.After(now) && missedRun.Missed < MAX_MISSED_RUNS {
+			missedRun.MissedAt = dueAt
+			missedRun.Missed++
+			dueAt = schedule.Next(dueAt)
+		}
+
+		if missedRun.Missed == 0 {
+			continue
+		}
+
+		missedRun.Job, err = jobParamsFor(&periodicJob)
+		if err != nil {
+			return nil, err
+		}
+
+		missedRuns = append(missedRuns, missedRun)
+	}
+
+	return missedRuns, nil
+}
+
+// MarkAsCaughtUp records the periodic job for 'missedRun' as having run now, so it's not caught up again
+func (adapter *WorkerPoolAdapter) MarkAsCaughtUp(missedRun MissedRun) error {
+	return missedRun.PeriodicJob.Update(map[string]interface{}{"last_run_at": time.Now()})
+}
+
+// PausePeriodicJob stops the periodic job with 'id' from being added to the queue, until it's resumed
+func (adapter *WorkerPoolAdapter) PausePeriodicJob(id interface{}) (*models.PeriodicJob, error) {
+	periodicJob, err := models.FindPeriodicJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	logg.Infof("Pausing periodic job %v", periodicJob.Name)
+	adapter.unschedulePeriodicJob(periodicJob.Name)
+
+	err = periodicJob.Update(map[string]interface{}{"paused": true, "next_run_at": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	return models.FindPeriodicJob(periodicJob.ID)
+}
+
+// ResumePeriodicJob schedules the paused periodic job with 'id', to be added to the queue periodically again
+func (adapter *WorkerPoolAdapter) ResumePeriodicJob(id interface{}) (*models.PeriodicJob, error) {
+	periodicJob, err := models.FindPeriodicJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !adapter.pool.hasHandler(periodicJob.Handler) {
+		return nil, ErrUnknownHandler
+	}
+
+	job, err := jobParamsFor(periodicJob)
+	if err != nil {
+		return nil, err
+	}
+
+	cronScheduler, err := adapter.cronSchedulerFor(periodicJob.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	nextRunAt, err := adapter.nextRunAt(periodicJob.CronExpression, cronScheduler.Location())
+	if err != nil {
+		return nil, err
+	}
+
+	logg.Infof("Resuming periodic job %v", periodicJob.Name)
+	adapter.unschedulePeriodicJob(periodicJob.Name)
+
+	err = adapter.schedulePeriodicJob(cronScheduler, periodicJob.CronExpression, job)
+	if err != nil {
+		return nil, err
+	}
+
+	err = periodicJob.Update(map[string]interface{}{"paused": false, "next_run_at": nextRunAt})
+	if err != nil {
+		return nil, err
+	}
+
+	return models.FindPeriodicJob(periodicJob.ID)
+}
+
+// TriggerPeriodicJob adds the periodic job with 'id' to the queue right away, even if it's paused.
+// Its next run is unchanged.
+func (adapter *WorkerPoolAdapter) TriggerPeriodicJob(id interface{}) (*models.PeriodicJob, error) {
+	periodicJob, err := models.FindPeriodicJob(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !adapter.pool.hasHandler(periodicJob.Handler) {
+		return nil, ErrUnknownHandler
+	}
+
+	job, err := jobParamsFor(periodicJob)
+	if err != nil {
+		return nil, err
+	}
+
+	logg.Infof("Triggering periodic job %v", periodicJob.Name)
+	err = adapter.Perform(job)
+	if err != nil {
+		return nil, err
+	}
+
+	err = periodicJob.Update(map[string]interface{}{"last_run_at": time.Now()})
+	if err != nil {
+		return nil, err
+	}
+
+	return models.FindPeriodicJob(periodicJob.ID)
+}
+
+// loadPeriodicJobs schedules the periodic jobs saved in the db, that aren't paused or already scheduled
+func (adapter *WorkerPoolAdapter) loadPeriodicJobs() error {
+	periodicJobs, err := models.AllPeriodicJobs()
+	if err != nil {
+		return err
+	}
+
+	loaded := 0
+	for i := range periodicJobs {
+		periodicJob := &periodicJobs[i]
+		if periodicJob.Paused || adapter.isPeriodicJobScheduled(periodicJob.Name) {
+			continue
+		}
+
+		if !adapter.pool.hasHandler(periodicJob.Handler) {
+			logg.Warnf("Periodic job %v not scheduled, as no handler is registered for '%v'",
+				periodicJob.Name, periodicJob.Handler)
+			continue
+		}
+
+		job, err := jobParamsFor(periodicJob)
+		if err != nil {
+			return err
+		}
+
+		err = adapter.PeriodicallyPerform(periodicJob.CronExpression, job)
+		if err != nil {
+			return err
+		}
+		loaded++
+	}
+
+	logg.Infof("%v periodic job(s) loaded from the db", loaded)
+	return nil
+}
+
+// schedulePeriodicJob adds 'job' to 'cronScheduler', to be added to the queue based on 'cronExpression'
+func (adapter *WorkerPoolAdapter) schedulePeriodicJob(
+	cronScheduler *gocron.Scheduler,
+	cronExpression string,
+	job JobParams) error {
+
+	var scheduler *gocron.Scheduler
+
+	// The scheduler will use a cron parser that expects a 6th field for seconds
+	if adapter.useCronParserWithSeconds {
+		scheduler = cronScheduler.CronWithSeconds(cronExpression)
+	} else {
+		scheduler = cronScheduler.Cron(cronExpression)
+	}
+
+	_, err := scheduler.Tag(job.Name).
+		Do(
+			func(job JobParams) {
+				err := adapter.Perform(job)
+				if err != nil {
+					logg.Error(err)
+				}
+
+				adapter.recordPeriodicJobRun(job.Name, cronExpression, cronScheduler.Location())
+			},
+			job,
+		)
+	return err
+}
+
+// recordPeriodicJobRun saves when the periodic job with 'name' last ran, and when it'll run next
+func (adapter *WorkerPoolAdapter) recordPeriodicJobRun(name, cronExpression string, location *time.Location) {
+	periodicJob, err := models.FindPeriodicJobByName(name)
+	if err != nil {
+		logg.Error(err)
+		return
+	}
+
+	update := map[string]interface{}{"last_run_at": time.Now()}
+	if nextRunAt, err := adapter.nextRunAt(cronExpression, location); err == nil {
+		update["next_run_at"] = nextRunAt
+	}
+
+	err = periodicJob.Update(update)
+	if err != nil {
+		logg.Error(err)
+	}
+}
+
+// unschedulePeriodicJob removes the periodic job with 'name' from the cron schedulers, keeping its definition
+func (adapter *WorkerPoolAdapter) unschedulePeriodicJob(name string) {
+	adapter.cronSchedulersMu.Lock()
+	defer adapter.cronSchedulersMu.Unlock()
+
+	for _, cronScheduler := range adapter.allCronSchedulers() {
+		cronScheduler.RemoveByTag(name)
+	}
+}
+
+// isPeriodicJobScheduled returns true if the periodic job with 'name' is in any of the cron schedulers
+func (adapter *WorkerPoolAdapter) isPeriodicJobScheduled(name string) bool {
+	adapter.cronSchedulersMu.Lock()
+	defer adapter.cronSchedulersMu.Unlock()
+
+	for _, cronScheduler := range adapter.allCronSchedulers() {
+		for _, job := range cronScheduler.Jobs() {
+			for _, tag := range job.Tags() {
+				if tag == name {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// nextRunAt returns when 'cronExpression' is next due in 'location', after now
+func (adapter *WorkerPoolAdapter) nextRunAt(cronExpression string, location *time.Location) (time.Time, error) {
+	schedule, err := adapter.parseCronExpression(cronExpression)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return schedule.Next(time.Now().In(location)), nil
+}
+
+// cronSchedule returns the schedule for 'cronExpression', along with the location for 'timeZone'
+func (adapter *WorkerPoolAdapter) cronSchedule(cronExpression, timeZone string) (cron.Schedule, *time.Location, error) {
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	schedule, err := adapter.parseCronExpression(cronExpression)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return schedule, location, nil
+}
+
+func (adapter *WorkerPoolAdapter) parseCronExpression(cronExpression string) (cron.Schedule, error) {
+	parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	if adapter.useCronParserWithSeconds {
+		parser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	}
+
+	return parser.Parse(cronExpression)
+}
+
+// jobParamsFor returns the params of the job added to the queue for 'periodicJob'
+func jobParamsFor(periodicJob *models.PeriodicJob) (JobParams, error) {
+	args := make(map[string]interface{})
+	if periodicJob.Args != "" {
+		err := json.Unmarshal([]byte(periodicJob.Args), &args)
+		if err != nil {
+			return JobParams{}, err
+		}
+	}
+
+	return JobParams{
+		Name:     periodicJob.Name,
+		Handler:  periodicJob.Handler,
+		Queue:    periodicJob.Queue,
+		Priority: periodicJob.Priority,
+		TimeZone: periodicJob.TimeZone,
+		Args:     args,
+	}, nil
+}
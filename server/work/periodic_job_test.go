@@ -0,0 +1,132 @@
+package work
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Daskott/kronus/server/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestPeriodicJobs(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+	workerPool.Register("tick", func(m map[string]interface{}) error { return nil })
+
+	err = workerPool.PeriodicallyPerform("not a cron", JobParams{Name: "tick", Handler: "tick"})
+	assert.NotNil(t, err, "Expected an invalid cron expression to be rejected")
+
+	err = workerPool.PeriodicallyPerform("0 0 18 * * 3", JobParams{
+		Name:     "tick",
+		Handler:  "tick",
+		TimeZone: "America/Toronto",
+		Args:     map[string]interface{}{"user_id": 1},
+	})
+	assert.Nil(t, err)
+
+	periodicJob, err := models.FindPeriodicJobByName("tick")
+	assert.Nil(t, err)
+	assert.Equal(t, "0 0 18 * * 3", periodicJob.CronExpression)
+	assert.Equal(t, "America/Toronto", periodicJob.TimeZone)
+	assert.Contains(t, periodicJob.Args, "user_id")
+	assert.NotNil(t, periodicJob.NextRunAt)
+	toronto, err := time.LoadLocation("America/Toronto")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Wednesday, periodicJob.NextRunAt.In(toronto).Weekday())
+	assert.Equal(t, 18, periodicJob.NextRunAt.In(toronto).Hour(), "Expected next run in the job's time zone")
+
+	// A paused job stays paused, even when it's performed again e.g. after a restart
+	periodicJob, err = workerPool.PausePeriodicJob(periodicJob.ID)
+	assert.Nil(t, err)
+	assert.True(t, periodicJob.Paused)
+	assert.Nil(t, periodicJob.NextRunAt)
+	assert.False(t, workerPool.isPeriodicJobScheduled("tick"))
+
+	err = workerPool.PeriodicallyPerform("0 0 18 * * 3", JobParams{Name: "tick", Handler: "tick"})
+	assert.Nil(t, err)
+	assert.False(t, workerPool.isPeriodicJobScheduled("tick"), "Expected a paused job to stay paused")
+
+	periodicJob, err = workerPool.ResumePeriodicJob(periodicJob.ID)
+	assert.Nil(t, err)
+	assert.False(t, periodicJob.Paused)
+	assert.NotNil(t, periodicJob.NextRunAt)
+	assert.True(t, workerPool.isPeriodicJobScheduled("tick"))
+
+	periodicJob, err = workerPool.TriggerPeriodicJob(periodicJob.ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, periodicJob.LastRunAt)
+
+	jobs, _, err := models.FetchJobsByStatus(models.ENQUEUED_JOB, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "tick", jobs[0].Name, "Expected a triggered job to be enqueued right away")
+
+	workerPool.RemovePeriodicJob("tick")
+	_, err = models.FindPeriodicJobByName("tick")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestUpdateJobScheduleByTag(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+	workerPool.Register("tock", func(m map[string]interface{}) error { return nil })
+
+	for _, name := range []string{"tock-1", "tock-10"} {
+		assert.Nil(t, workerPool.PeriodicallyPerform("0 0 18 * * 3", JobParams{Name: name, Handler: "tock"}))
+		defer workerPool.RemovePeriodicJob(name)
+	}
+
+	assert.ErrorIs(t, workerPool.UpdateJobScheduleByTag("tock", "0 0 9 * * 1"), ErrJobNotFoundInCronSch)
+
+	assert.Nil(t, workerPool.UpdateJobScheduleByTag("tock-1", "0 0 9 * * 1"))
+
+	periodicJob, err := models.FindPeriodicJobByName("tock-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "0 0 9 * * 1", periodicJob.CronExpression, "Expected the new schedule to be saved")
+	assert.Equal(t, time.Monday, periodicJob.NextRunAt.UTC().Weekday())
+	assert.True(t, workerPool.isPeriodicJobScheduled("tock-1"))
+
+	periodicJob, err = models.FindPeriodicJobByName("tock-10")
+	assert.Nil(t, err)
+	assert.Equal(t, "0 0 18 * * 3", periodicJob.CronExpression, "Expected only the job with the exact tag to be updated")
+}
+
+func TestStartLoadsPeriodicJobs(t *testing.T) {
+	models.InitializeTestDb()
+
+	workerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	err = workerPool.PeriodicallyPerform("*/1 * * * * *", JobParams{Name: "tock", Handler: "tock"})
+	assert.Nil(t, err)
+
+	// A new adapter e.g. after a restart, should schedule the periodic jobs saved in the db
+	restartedWorkerPool, err := NewWorkerAdapter("UTC", true)
+	assert.Nil(t, err)
+
+	ran := make(chan struct{}, 10)
+	restartedWorkerPool.Register("tock", func(m map[string]interface{}) error {
+		ran <- struct{}{}
+		return nil
+	})
+
+	assert.Nil(t, restartedWorkerPool.Start())
+	defer restartedWorkerPool.Stop()
+	assert.True(t, restartedWorkerPool.isPeriodicJobScheduled("tock"))
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected periodic job loaded from the db to run")
+	}
+
+	periodicJob, err := models.FindPeriodicJobByName("tock")
+	assert.Nil(t, err)
+	assert.NotNil(t, periodicJob.LastRunAt, "Expected when the job last ran to be saved")
+
+	restartedWorkerPool.RemovePeriodicJob("tock")
+}
@@ -10,14 +10,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// The longest the scheduled job requeuer sleeps, before checking for scheduled jobs to be queued.
+// It's a safety net, as it's woken up when jobs are scheduled.
+const MAX_SCHEDULED_REQUEUER_SLEEP = time.Minute
+
 type requeuer struct {
 	fromQueue string
 	stopChan  chan struct{}
+
+	// Wakes up workers when jobs are requeued, and the scheduled job requeuer when jobs are scheduled
+	notifier *notifier
 }
 
 var supportedQueues = map[string]bool{models.IN_PROGRESS_JOB: true, models.SCHEDULED_JOB: true}
 
-func newRequeuer(fromQueue string) (*requeuer, error) {
+func newRequeuer(fromQueue string, notifier *notifier) (*requeuer, error) {
 	if !supportedQueues[fromQueue] {
 		return nil, fmt.Errorf("%v is not a supported queue, must be in %v", fromQueue, supportedQueues)
 	}
@@ -25,6 +32,7 @@ func newRequeuer(fromQueue string) (*requeuer, error) {
 	return &requeuer{
 		fromQueue: fromQueue,
 		stopChan:  make(chan struct{}),
+		notifier:  notifier,
 	}, nil
 }
 
@@ -42,9 +50,6 @@ func (r *requeuer) loop() {
 	var job *models.Job
 	var err error
 
-	// At some point we may need an expnential back-off,
-	// but for now keep it simple
-	sleepBackOff := 5
 	rateLimiter := time.NewTicker(DefaultTickerDuration)
 	defer rateLimiter.Stop()
 
@@ -54,12 +59,15 @@ func (r *requeuer) loop() {
 		case <-r.stopChan:
 			logg.Infof("Stopping %s job requeuer", r.fromQueue)
 			return
+		case <-r.wakeup():
+			// A job was scheduled, which may be due before the one the requeuer is sleeping until
+			rateLimiter.Reset(DefaultTickerDuration)
 		case <-rateLimiter.C:
 			job, err = r.nextJob()
 
-			// If no job found, sleep for 'sleepBackOff' seconds
+			// If no job found, sleep until the next job may need to be requeued
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				rateLimiter.Reset(time.Duration(sleepBackOff) * time.Second)
+				rateLimiter.Reset(r.sleepDuration())
 				continue
 			}
 
@@ -85,6 +93,45 @@ func (r *requeuer) nextJob() (*models.Job, error) {
 	return models.FirstScheduledJobToBeQueued()
 }
 
+// wakeup returns the channel the requeuer is woken up on. Only the scheduled job requeuer is woken up,
+// as jobs get stuck 'in-progress' without notice.
+func (r *requeuer) wakeup() <-chan struct{} {
+	if r.fromQueue == models.SCHEDULED_JOB {
+		return r.notifier.scheduled
+	}
+	return nil
+}
+
+// sleepDuration returns how long to sleep when there's no job to requeue i.e. for the scheduled job requeuer,
+// until the next scheduled job is due. Otherwise, a fixed no. of seconds.
+func (r *requeuer) sleepDuration() time.Duration {
+	// At some point we may need an expnential back-off for stuck jobs,
+	// but for now keep it simple
+	if r.fromQueue == models.IN_PROGRESS_JOB {
+		return 5 * time.Second
+	}
+
+	nextAt, err := models.NextScheduledJobAt()
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			r.logError(err)
+		}
+		return MAX_SCHEDULED_REQUEUER_SLEEP
+	}
+
+	// Jobs are due at a 1 second resolution, so don't wake up more often than that
+	sleep := time.Until(nextAt)
+	if sleep < time.Second {
+		sleep = time.Second
+	}
+
+	if sleep > MAX_SCHEDULED_REQUEUER_SLEEP {
+		sleep = MAX_SCHEDULED_REQUEUER_SLEEP
+	}
+
+	return sleep
+}
+
 func (r *requeuer) requeue(job *models.Job) {
 	jobStatus, err := models.FindJobStatus(models.ENQUEUED_JOB)
 	if err != nil {
@@ -100,8 +147,13 @@ func (r *requeuer) requeue(job *models.Job) {
 	err = job.Update(update)
 	if err != nil {
 		r.logError(err)
+		return
 	}
 
+	job.Claimed = false
+	job.EnqueuedAt = update["enqueued_at"].(time.Time)
+	models.PublishJobEvent(*job, jobStatus)
+	r.notifier.notifyQueue(job.Queue)
 	r.logInfof("job with id=%v requeued", job.ID)
 }
 
@@ -1,6 +1,7 @@
 package work
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,12 @@ import (
 
 const MAX_FAILS = 4
 
+// How long a job can run before it's cancelled & counted as failed, unless its handler has a timeout
+const DEFAULT_JOB_TIMEOUT = 5 * time.Minute
+
+// How often a job in progress is touched, so it's not taken for a stuck job while its handler is running
+const JOB_HEARTBEAT_INTERVAL = time.Minute
+
 var (
 	DefaultTickerDuration = 5 * time.Millisecond
 	TickerDurationOnError = 10 * time.Millisecond
@@ -27,47 +34,134 @@ type JobParams struct {
 	Name    string
 	Handler string
 	Args    map[string]interface{}
+
+	// Name of the queue the job is processed from e.g. 'messages'. Defaults to 'DEFAULT_QUEUE'.
+	Queue string
+
+	// Jobs with a higher priority are picked up from their queue first e.g. 'HIGHEST_PRIORITY'.
+	// Defaults to the priority the handler was registered with, otherwise 'NORMAL_PRIORITY'.
+	Priority int
+
+	// Time zone the cron expression of a periodic job is evaluated in e.g. 'America/Toronto'.
+	// Only used by 'PeriodicallyPerform', and defaults to the adapter's time zone.
+	TimeZone string
 }
 
 type Handler func(map[string]interface{}) error
 
+// ContextHandler is a handler that's passed a context, which is cancelled when the job times out
+// or the worker pool is stopped. Long running calls e.g. to Twilio or GCS should use it to return early.
+type ContextHandler func(context.Context, map[string]interface{}) error
+
+// WithContext adapts 'handler' to a 'ContextHandler' that ignores its context.
+// It can't be cancelled, so the worker waits for it to return even after its context is cancelled.
+func WithContext(handler Handler) ContextHandler {
+	return func(_ context.Context, args map[string]interface{}) error {
+		return handler(args)
+	}
+}
+
+// HandlerOptions are the defaults for jobs performed by a handler
+type HandlerOptions struct {
+	// The priority of the handler's jobs, unless one is given in 'JobParams'
+	Priority int
+
+	// Max no. of times a job is attempted before it's marked as 'dead'. Defaults to 'MAX_FAILS'.
+	MaxAttempts int
+
+	// How long a failed job waits in the 'scheduled' queue before it's retried. Defaults to 'DefaultBackoffPolicy'.
+	Backoff *BackoffPolicy
+
+	// How long a job can run before it's cancelled & counted as failed. Defaults to 'DEFAULT_JOB_TIMEOUT'.
+	Timeout time.Duration
+}
+
+// withDefaults returns the options, with the defaults for any option that's not set
+func (options HandlerOptions) withDefaults() HandlerOptions {
+	if options.MaxAttempts == 0 {
+		options.MaxAttempts = MAX_FAILS
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = DEFAULT_JOB_TIMEOUT
+	}
+
+	backoff := DefaultBackoffPolicy
+	if options.Backoff != nil {
+		backoff = options.Backoff.withDefaults()
+	}
+	options.Backoff = &backoff
+
+	return options
+}
+
+func (options HandlerOptions) validate() error {
+	if options.Priority != 0 && !isValidPriority(options.Priority) {
+		return ErrInvalidPriority
+	}
+
+	if options.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts can't be negative")
+	}
+
+	if options.Timeout < 0 {
+		return fmt.Errorf("timeout can't be negative")
+	}
+
+	if options.Backoff != nil {
+		return options.Backoff.validate()
+	}
+
+	return nil
+}
+
 type worker struct {
 	id                     string
-	handlers               map[string]Handler
+	queue                  string
+	handlers               map[string]ContextHandler
+	handlerOptions         map[string]HandlerOptions
 	stopChan               chan struct{}
 	sleepBackoffsInSeconds []int64
+
+	// Wakes up the worker when a job is added to its queue, or the scheduled job requeuer when a failed job is scheduled
+	notifier *notifier
 }
 
-func newWorker(sleepBackoffsInSeconds []int64) *worker {
+func newWorker(queue string, sleepBackoffsInSeconds []int64, notifier *notifier) *worker {
 	return &worker{
 		id:                     makeIdentifier(),
-		handlers:               make(map[string]Handler),
+		queue:                  queue,
+		handlers:               make(map[string]ContextHandler),
+		handlerOptions:         make(map[string]HandlerOptions),
 		stopChan:               make(chan struct{}),
 		sleepBackoffsInSeconds: sleepBackoffsInSeconds,
+		notifier:               notifier,
 	}
 }
 
-// registerHandler binds a name to a job handler.
-func (w *worker) registerHandler(name string, handler Handler) error {
+// registerHandler binds a name to a job handler, with 'options' for its jobs.
+func (w *worker) registerHandler(name string, handler ContextHandler, options HandlerOptions) error {
 	if _, ok := w.handlers[name]; ok {
 		return ErrDuplicateHandler
 	}
 
 	w.handlers[name] = handler
+	w.handlerOptions[name] = options.withDefaults()
 
 	return nil
 }
 
-// start starts the worker loop that pulls jobs from the queue & process them
-func (w *worker) start() {
-	go w.loop()
+// start starts the worker loop that pulls jobs from the queue & process them.
+// Jobs are cancelled once 'ctx' is done, and released back to the queue.
+func (w *worker) start(ctx context.Context) {
+	go w.loop(ctx)
 }
 
 func (w *worker) stop() {
 	w.stopChan <- struct{}{}
 }
 
-func (w *worker) loop() {
+func (w *worker) loop(ctx context.Context) {
 	var consequtiveNoJobs int64
 	var currentJob *models.Job
 	var err error
@@ -76,18 +170,23 @@ func (w *worker) loop() {
 	rateLimiter := time.NewTicker(DefaultTickerDuration)
 	defer rateLimiter.Stop()
 
-	logg.Infof("Starting worker %s", w.id)
+	logg.Infof("Starting worker %s for %s queue", w.id, w.queue)
 	for {
 		select {
 		case <-w.stopChan:
 			logg.Infof("Stopping worker %s", w.id)
 			return
+		case <-w.notifier.queue(w.queue):
+			// A job was added to the queue, so fetch it right away instead of waiting for the next poll
+			rateLimiter.Reset(DefaultTickerDuration)
+			consequtiveNoJobs = 0
 		case <-rateLimiter.C:
-			currentJob, err = models.FirstJob(models.ENQUEUED_JOB, false)
+			currentJob, err = models.FirstJob(models.ENQUEUED_JOB, false, w.queue)
 			if err != nil {
 				if errors.Is(err, gorm.ErrRecordNotFound) {
 					// If no job found, slowly increase the wait time between each job fetch
 					// using 'sleepBackoffsInSeconds'. To reduce db hit when it's not necessary.
+					// Polling is only a safety net, as the worker is woken up when a job is added to its queue.
 					consequtiveNoJobs++
 					idx := consequtiveNoJobs
 					if idx >= int64(len(sleepBackoffs)) {
@@ -117,59 +216,198 @@ func (w *worker) loop() {
 				continue
 			}
 
-			w.processJob(currentJob)
+			w.processJob(ctx, currentJob)
 			rateLimiter.Reset(DefaultTickerDuration)
 			consequtiveNoJobs = 0
 		}
 	}
 }
 
-func (w *worker) processJob(job *models.Job) {
+func (w *worker) processJob(ctx context.Context, job *models.Job) {
+	startedAt := time.Now()
+
 	args := make(map[string]interface{})
 	err := json.Unmarshal([]byte(job.Args), &args)
 	if err != nil {
 		logg.Error(err)
+		w.recordAttempt(job, startedAt, models.FAILED_JOB_ATTEMPT, err)
+		w.determineFailedJobFate(job, err)
+		return
+	}
+
+	handler, ok := w.handlers[job.Handler]
+	if !ok {
+		err = fmt.Errorf("no handler registered for '%v'", job.Handler)
+		w.logError(err)
+		w.recordAttempt(job, startedAt, models.FAILED_JOB_ATTEMPT, err)
 		w.determineFailedJobFate(job, err)
 		return
 	}
 
-	err = w.handlers[job.Handler](args)
+	err = w.runHandler(ctx, job, handler, w.handlerOptions[job.Handler].Timeout, args)
+
+	// If the worker is stopping, the job didn't get a fair chance to run. So release it instead of failing it
+	if err != nil && ctx.Err() != nil {
+		w.recordAttempt(job, startedAt, models.RELEASED_JOB_ATTEMPT, err)
+		w.releaseJob(job)
+		return
+	}
+
 	if err != nil {
 		w.logError(err)
+		w.recordAttempt(job, startedAt, models.FAILED_JOB_ATTEMPT, err)
 		w.determineFailedJobFate(job, err)
 		return
 	}
+
+	w.recordAttempt(job, startedAt, models.SUCCEEDED_JOB_ATTEMPT, nil)
 	w.markJobAsSuccessful(job)
 }
 
+// recordAttempt saves the execution of 'job' that started at 'startedAt', with its 'outcome' & 'runError' if any.
+// It's saved before the job's status changes, so the attempt is always there once the job has moved on.
+func (w *worker) recordAttempt(job *models.Job, startedAt time.Time, outcome string, runError error) {
+	endedAt := time.Now()
+	attempt := models.JobAttempt{
+		JobID:        job.ID,
+		WorkerID:     w.id,
+		StartedAt:    startedAt,
+		EndedAt:      endedAt,
+		DurationInMs: endedAt.Sub(startedAt).Milliseconds(),
+		Outcome:      outcome,
+	}
+
+	if runError != nil {
+		attempt.Error = runError.Error()
+	}
+
+	err := models.CreateJobAttempt(&attempt)
+	if err != nil {
+		w.logError(err)
+	}
+}
+
+// runHandler runs 'handler' for 'job' until it returns. Its context is cancelled after 'timeout' or when 'ctx'
+// is done, but the worker still waits for it to return, so a job is never retried or released while its handler
+// is running. If the handler returns an error after its context is cancelled, the context's error is returned.
+func (w *worker) runHandler(
+	ctx context.Context,
+	job *models.Job,
+	handler ContextHandler,
+	timeout time.Duration,
+	args map[string]interface{}) error {
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- handler(handlerCtx, args)
+	}()
+
+	heartbeat := time.NewTicker(JOB_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+
+	cancelled := handlerCtx.Done()
+	for {
+		select {
+		case err := <-done:
+			// The handler finished its work regardless e.g. it ignores its context
+			if err == nil || handlerCtx.Err() == nil {
+				return err
+			}
+
+			if errors.Is(handlerCtx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("job timed out after %v: %w", timeout, handlerCtx.Err())
+			}
+			return handlerCtx.Err()
+		case <-cancelled:
+			w.logInfof("waiting for job with id=%v to return after it was cancelled: %v", job.ID, handlerCtx.Err())
+			cancelled = nil
+		case <-heartbeat.C:
+			// So the in-progress job requeuer doesn't take the job for a stuck one, while its handler is running
+			if err := job.Update(map[string]interface{}{"updated_at": time.Now()}); err != nil {
+				w.logError(err)
+			}
+		}
+	}
+}
+
+// releaseJob moves the claimed 'job' back to the queue as it was, to be picked up by another worker
+func (w *worker) releaseJob(job *models.Job) {
+	jobStatus, err := models.FindJobStatus(models.ENQUEUED_JOB)
+	if err != nil {
+		w.logError(err)
+		return
+	}
+
+	err = job.Update(map[string]interface{}{
+		"claimed":       false,
+		"job_status_id": jobStatus.ID,
+	})
+	if err != nil {
+		w.logError(err)
+		return
+	}
+
+	job.Claimed = false
+	models.PublishJobEvent(*job, jobStatus)
+	w.notifier.notifyQueue(job.Queue)
+	w.logInfof("job with id=%v released back to the queue", job.ID)
+}
+
+// determineFailedJobFate marks the failed 'job' as 'dead' if it has been attempted the max no. of times
+// for its handler, otherwise it's scheduled to be retried after the handler's backoff.
 func (w *worker) determineFailedJobFate(job *models.Job, runError error) {
 	var jobStatus *models.JobStatus
 	var err error
 
+	options, ok := w.handlerOptions[job.Handler]
+	if !ok {
+		options = HandlerOptions{}.withDefaults()
+	}
+
 	job.Fails++
 
-	// For job with Fails >= MAX_FAILS mark as DEAD else requeue the job to be retried
-	if job.Fails >= MAX_FAILS {
+	update := map[string]interface{}{
+		"claimed":    false,
+		"fails":      job.Fails,
+		"last_error": runError.Error(),
+	}
+
+	if job.Fails >= options.MaxAttempts {
 		jobStatus, err = models.FindJobStatus(models.DEAD_JOB)
 	} else {
-		jobStatus, err = models.FindJobStatus(models.ENQUEUED_JOB)
+		jobStatus, err = models.FindJobStatus(models.SCHEDULED_JOB)
+		update["add_to_queue_at"] = time.Now().Add(options.Backoff.Delay(job.Fails))
 	}
 
 	if err != nil {
 		w.logError(err)
 		return
 	}
+	update["job_status_id"] = jobStatus.ID
 
 	// Unclaim job and update it with the necessary fail information
-	err = job.Update(map[string]interface{}{
-		"claimed":       false,
-		"job_status_id": jobStatus.ID,
-		"fails":         job.Fails,
-		"last_error":    runError.Error(),
-	})
+	err = job.Update(update)
 	if err != nil {
 		w.logError(err)
+		return
+	}
+
+	job.Claimed = false
+	job.LastError = runError.Error()
+	if addToQueueAt, ok := update["add_to_queue_at"].(time.Time); ok {
+		job.AddToQueueAt = addToQueueAt
+		w.notifier.notifyScheduled()
+		w.logInfof("job with id=%v failed, retrying at %v", job.ID, addToQueueAt)
 	}
+
+	models.PublishJobEvent(*job, jobStatus)
 	w.logInfof("job with id=%v completed with status=%v", job.ID, jobStatus.Name)
 }
 
@@ -187,16 +425,20 @@ func (w *worker) markJobAsSuccessful(job *models.Job) {
 	err = job.Update(update)
 	if err != nil {
 		w.logError(err)
+		return
 	}
+
+	job.Claimed = false
+	models.PublishJobEvent(*job, jobStatus)
 	w.logInfof("job with id=%v completed with status=%v", job.ID, jobStatus.Name)
 }
 
 func (w *worker) logInfof(template string, args ...interface{}) {
-	prefix := colors.Yellow((fmt.Sprintf("[worker %v] ", w.id)))
+	prefix := colors.Yellow((fmt.Sprintf("[worker %v:%v] ", w.queue, w.id)))
 	logg.Infof(prefix+template, args...)
 }
 
 func (w *worker) logError(args ...interface{}) {
-	prefix := colors.Red((fmt.Sprintf("[worker %v] ", w.id)))
+	prefix := colors.Red((fmt.Sprintf("[worker %v:%v] ", w.queue, w.id)))
 	logg.Errorf(prefix, args...)
 }
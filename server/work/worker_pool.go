@@ -1,6 +1,7 @@
 package work
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -12,47 +13,82 @@ import (
 )
 
 type workerPool struct {
-	handlers    map[string]Handler
-	workers     []*worker
-	retrier     *requeuer
-	scheduler   *requeuer
-	concurrency int
-	started     bool
+	handlers  map[string]ContextHandler
+	workers   []*worker
+	retrier   *requeuer
+	scheduler *requeuer
+	notifier  *notifier
+	started   bool
+
+	// Cancels the context of jobs being processed, when the pool is stopped
+	cancel context.CancelFunc
+
+	// No. of workers for each named queue
+	queues map[string]int
+
+	// Defaults for the jobs of each handler, keyed by handler name
+	handlerOptions map[string]HandlerOptions
 }
 
+// newWorkerPool creates a pool with 'concurrency' workers for each of the 'DefaultQueues'
 func newWorkerPool(concurrency int) (*workerPool, error) {
-	retrier, err := newRequeuer(models.IN_PROGRESS_JOB)
+	queues := make(map[string]int)
+	for queue := range DefaultQueues {
+		queues[queue] = concurrency
+	}
+
+	return newWorkerPoolWithQueues(queues)
+}
+
+// newWorkerPoolWithQueues creates a pool with workers for each of the named 'queues', keyed by the no. of workers
+func newWorkerPoolWithQueues(queues map[string]int) (*workerPool, error) {
+	notifier := newNotifier(queues)
+
+	retrier, err := newRequeuer(models.IN_PROGRESS_JOB, notifier)
 	if err != nil {
 		return nil, err
 	}
 
-	scheduler, err := newRequeuer(models.SCHEDULED_JOB)
+	scheduler, err := newRequeuer(models.SCHEDULED_JOB, notifier)
 	if err != nil {
 		return nil, err
 	}
 
 	wp := workerPool{
-		handlers:    make(map[string]Handler),
-		concurrency: concurrency,
-		retrier:     retrier,
-		scheduler:   scheduler,
+		handlers:       make(map[string]ContextHandler),
+		retrier:        retrier,
+		scheduler:      scheduler,
+		notifier:       notifier,
+		queues:         queues,
+		handlerOptions: make(map[string]HandlerOptions),
 	}
 
-	for i := 0; i < concurrency; i++ {
-		wp.workers = append(wp.workers, newWorker([]int64{0, 1, 2, 5, 15, 30}))
+	for queue, concurrency := range queues {
+		if strings.TrimSpace(queue) == "" || concurrency < 1 {
+			return nil, fmt.Errorf("queue '%v' must have a name & at least 1 worker", queue)
+		}
+
+		for i := 0; i < concurrency; i++ {
+			wp.workers = append(wp.workers, newWorker(queue, []int64{0, 1, 5, 15, 30, 60}, notifier))
+		}
 	}
 
 	return &wp, nil
 }
 
 // registerHandler binds a name to a job handler for all workers in pool
-func (wp *workerPool) registerHandler(name string, handler Handler) error {
+func (wp *workerPool) registerHandler(name string, handler ContextHandler, options HandlerOptions) error {
 	if _, ok := wp.handlers[name]; ok {
 		return ErrDuplicateHandler
 	}
 
+	if err := options.validate(); err != nil {
+		return err
+	}
+	wp.handlerOptions[name] = options
+
 	for _, worker := range wp.workers {
-		err := worker.registerHandler(name, handler)
+		err := worker.registerHandler(name, handler, options)
 
 		// Only panic if we get an error that is unexpected i.e !ErrDuplicateHandler
 		if err != nil && !errors.Is(err, ErrDuplicateHandler) {
@@ -62,6 +98,48 @@ func (wp *workerPool) registerHandler(name string, handler Handler) error {
 	return nil
 }
 
+// hasHandler returns true if a handler is bound to 'name' for the workers in pool
+func (wp *workerPool) hasHandler(name string) bool {
+	for _, worker := range wp.workers {
+		if _, ok := worker.handlers[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// queueFor returns the queue for 'job', and an error if the pool has no workers for it
+func (wp *workerPool) queueFor(job JobParams) (string, error) {
+	queue := job.Queue
+	if queue == "" {
+		queue = DEFAULT_QUEUE
+	}
+
+	if _, ok := wp.queues[queue]; !ok {
+		return "", fmt.Errorf("%w: %v", ErrUnknownQueue, queue)
+	}
+
+	return queue, nil
+}
+
+// priorityFor returns the priority for 'job', and an error if it's not a valid priority
+func (wp *workerPool) priorityFor(job JobParams) (int, error) {
+	priority := job.Priority
+	if priority == 0 {
+		priority = wp.handlerOptions[job.Handler].Priority
+	}
+
+	if priority == 0 {
+		priority = NORMAL_PRIORITY
+	}
+
+	if !isValidPriority(priority) {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidPriority, priority)
+	}
+
+	return priority, nil
+}
+
 // enqueue adds a job to the queue(to be executed) by creating a DB record based on 'JobParams' provided.
 // Each job is unique by name. Can't have more than one job with the same name 'enqueued' or 'in-progress'
 // at the same time.
@@ -70,30 +148,68 @@ func (wp *workerPool) enqueue(job JobParams) error {
 		return fmt.Errorf("both a name & handler is required for a job")
 	}
 
+	queue, err := wp.queueFor(job)
+	if err != nil {
+		return err
+	}
+
+	priority, err := wp.priorityFor(job)
+	if err != nil {
+		return err
+	}
+
 	argsAsJson, err := json.Marshal(job.Args)
 	if err != nil {
 		return err
 	}
 
 	// This ensures that all jobs currently in the queue or in-progress are unique
-	return models.CreateUniqueJobByName(job.Name, job.Handler, string(argsAsJson))
+	err = models.CreateUniqueJobByName(job.Name, job.Handler, queue, priority, string(argsAsJson))
+	if err != nil {
+		return err
+	}
+
+	wp.notifier.notifyQueue(queue)
+	return nil
 }
 
 func (wp *workerPool) enqueueIn(secondsInFuture int, job JobParams) error {
+	return wp.enqueueAt(time.Now().Add(time.Duration(secondsInFuture)*time.Second), job)
+}
+
+// enqueueAt schedules a job to be added to the queue at 'addToQueueAt'
+func (wp *workerPool) enqueueAt(addToQueueAt time.Time, job JobParams) error {
 	if strings.TrimSpace(job.Name) == "" || strings.TrimSpace(job.Handler) == "" {
 		return fmt.Errorf("both a name & handler is required for a job")
 	}
 
+	queue, err := wp.queueFor(job)
+	if err != nil {
+		return err
+	}
+
+	priority, err := wp.priorityFor(job)
+	if err != nil {
+		return err
+	}
+
 	argsAsJson, err := json.Marshal(job.Args)
 	if err != nil {
 		return err
 	}
 
-	return models.CreateScheduledJob(
-		job.Name, job.Handler,
+	err = models.CreateScheduledJob(
+		job.Name, job.Handler, queue, priority,
 		string(argsAsJson),
-		time.Now().Add(time.Duration(secondsInFuture)*time.Second),
+		addToQueueAt,
 	)
+	if err != nil {
+		return err
+	}
+
+	// The job may be due before the one the scheduled job requeuer is waiting for
+	wp.notifier.notifyScheduled()
+	return nil
 }
 
 // start starts all workers in pool & job reaper i.e the workers can start processing jobs
@@ -103,20 +219,26 @@ func (wp *workerPool) start() {
 	}
 	wp.started = true
 
+	ctx, cancel := context.WithCancel(context.Background())
+	wp.cancel = cancel
+
 	for _, worker := range wp.workers {
-		go worker.start()
+		go worker.start(ctx)
 	}
 
 	wp.retrier.start()
 	wp.scheduler.start()
 }
 
-// stop stops all workers in pool & job reaper i.e jobs will stop being processed
+// stop stops all workers in pool & job reaper i.e jobs will stop being processed.
+// Jobs being processed are cancelled & released back to the queue.
 func (wp *workerPool) stop() {
 	if !wp.started {
 		return
 	}
 
+	wp.cancel()
+
 	wg := sync.WaitGroup{}
 	for _, w := range wp.workers {
 		wg.Add(1)
@@ -1,10 +1,12 @@
 package shared
 
 type ServerConfig struct {
-	Sqlite SqliteConfig `mapstructure:"sqlite" validate:"required"`
-	Kronus KronusConfig `mapstructure:"kronus" validate:"required"`
-	Google GoogleConfig `mapstructure:"google"`
-	Twilio TwilioConfig `mapstructure:"twilio"`
+	Sqlite    SqliteConfig    `mapstructure:"sqlite" validate:"required"`
+	Kronus    KronusConfig    `mapstructure:"kronus" validate:"required"`
+	Google    GoogleConfig    `mapstructure:"google"`
+	Twilio    TwilioConfig    `mapstructure:"twilio"`
+	Messenger MessengerConfig `mapstructure:"messenger"`
+	Smtp      SmtpConfig      `mapstructure:"smtp"`
 }
 
 type SqliteConfig struct {
@@ -16,6 +18,7 @@ type KronusConfig struct {
 	Cron          CronConfig     `mapstructure:"cron" validate:"required"`
 	Listener      ListenerConfig `mapstructure:"listener" validate:"required"`
 	PublicUrl     string         `mapstructure:"publicUrl" validate:"required"`
+	Workers       WorkersConfig  `mapstructure:"workers"`
 }
 
 type GoogleConfig struct {
@@ -25,6 +28,29 @@ type GoogleConfig struct {
 
 type CronConfig struct {
 	TimeZone string `mapstructure:"timeZone" validate:"required"`
+
+	// Probes missed within this many hours before the server starts e.g. during downtime, are caught up.
+	// 0 turns off catch-up.
+	CatchUpWindowInHours int `mapstructure:"catchUpWindowInHours" validate:"min=0"`
+}
+
+type WorkersConfig struct {
+	// No. of workers for the default queue
+	Concurrency int `mapstructure:"concurrency" validate:"omitempty,min=1"`
+
+	// No. of workers for each named queue e.g. 'messages' or 'maintenance'
+	Queues map[string]int `mapstructure:"queues" validate:"omitempty,dive,keys,required,endkeys,min=1"`
+
+	Retention JobRetentionConfig `mapstructure:"retention"`
+}
+
+type JobRetentionConfig struct {
+	// No. of days 'successful' & 'dead' jobs are kept before they're deleted. 0 keeps them forever.
+	SuccessfulJobsInDays int `mapstructure:"successfulJobsInDays" validate:"min=0"`
+	DeadJobsInDays       int `mapstructure:"deadJobsInDays" validate:"min=0"`
+
+	// How often jobs past their retention are deleted in cron format
+	PruneSchedule string `mapstructure:"pruneSchedule" validate:"required"`
 }
 
 type ListenerConfig struct {
@@ -43,3 +69,17 @@ type TwilioConfig struct {
 	AuthToken           string `mapstructure:"authToken" validate:"required"`
 	MessagingServiceSid string `mapstructure:"messagingServiceSid" validate:"required"`
 }
+
+type MessengerConfig struct {
+	// Driver is the name of the messenger driver used to send probe messages e.g. 'twilio'
+	Driver string `mapstructure:"driver" validate:"required"`
+}
+
+type SmtpConfig struct {
+	Host        string      `mapstructure:"host" validate:"required_with=EnableEmail"`
+	Port        int         `mapstructure:"port" validate:"required_with=EnableEmail"`
+	Username    string      `mapstructure:"username"`
+	Password    string      `mapstructure:"password" validate:"required_with=Username"`
+	From        string      `mapstructure:"from" validate:"required_with=EnableEmail,omitempty,email"`
+	EnableEmail interface{} `mapstructure:"enableEmail" validate:"omitempty,bool"`
+}